@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -87,11 +88,34 @@ func GetKeyFilesForRole(role string) (string, string) {
 var Version = "*undefined*"
 
 type Config struct {
-	LogLevel             string
-	HttpListenAddress    string
-	ScanTimeout          int // Seconds to scan for BLE devices
-	CacheMaxAge          int // Seconds for HTTP Cache-Control header max-age (used for body controller state responses). If set to 0, cache headers are disabled.
-	VehicleDataCacheTime int // Seconds to cache VehicleData endpoint responses in memory. Each endpoint is cached separately per VIN.
+	LogLevel              string
+	HttpListenAddress     string
+	TlsEnabled            bool     // Serve HTTPS instead of HTTP
+	TlsCertFile           string   // Certificate of the HTTPS listener. Empty generates a self-signed certificate.
+	TlsKeyFile            string   // Key of the certificate
+	TlsClientCaFile       string   // CA that signed the client certificates. Empty does not require client certificates.
+	ScanTimeout           int      // Seconds to scan for BLE devices
+	CacheMaxAge           int      // Seconds for HTTP Cache-Control header max-age (used for body controller state responses). If set to 0, cache headers are disabled.
+	VehicleDataCacheTime  int      // Seconds to cache VehicleData endpoint responses in memory. Each endpoint is cached separately per VIN.
+	MaxConcurrentSessions int      // Maximum number of vehicles connected at the same time. Depends on the BLE adapter.
+	KeepAlive             bool     // Keep the connection open with periodic VCSEC pings until the vehicle goes to sleep or the link fails.
+	KeepAliveInterval     int      // Seconds between two keep-alive pings.
+	CommandTtlHigh        int      // Seconds a high priority command may wait in the queue before it is dropped. 0 never expires.
+	CommandTtlNormal      int      // Seconds a normal priority command may wait in the queue before it is dropped. 0 never expires.
+	CommandTtlLow         int      // Seconds a low priority command may wait in the queue before it is dropped. 0 never expires.
+	PollVins              []string // Vehicles whose vehicle data is polled in the background. Empty disables polling.
+	PollEndpoints         []string // Vehicle data endpoints that are polled.
+	PollIntervalState     int      // Seconds between two body controller state reads (VCSEC only, does not wake the vehicle).
+	PollIntervalCharging  int      // Seconds between two vehicle data fetches while the vehicle is charging.
+	PollIntervalIdle      int      // Seconds between two vehicle data fetches while the vehicle is awake and not charging.
+	MqttBroker            string   // MQTT broker URL (e.g. tcp://localhost:1883). Empty disables MQTT.
+	MqttUsername          string
+	MqttPassword          string
+	MqttClientId          string
+	MqttTopicPrefix       string   // Prefix of all MQTT topics
+	MqttDiscovery         bool     // Publish Home Assistant MQTT discovery configs
+	MqttDiscoveryPrefix   string   // Home Assistant discovery prefix
+	MqttScopes            []string // API token scopes of the commands that are accepted via MQTT
 }
 
 var AppConfig *Config
@@ -112,6 +136,16 @@ func LoadConfig() *Config {
 	}
 	logging.Info("Env:", "httpListenAddress", addr)
 
+	tlsCertFile := os.Getenv("tlsCertFile")
+	tlsKeyFile := os.Getenv("tlsKeyFile")
+	tlsClientCaFile := os.Getenv("tlsClientCaFile")
+	// Configured certificates imply HTTPS
+	tlsEnabled := os.Getenv("tls") == "true" || tlsCertFile != "" || tlsClientCaFile != ""
+	logging.Info("Env:", "tls", tlsEnabled)
+	if tlsEnabled {
+		logging.Info("Env:", "tlsCertFile", tlsCertFile, "tlsKeyFile", tlsKeyFile, "tlsClientCaFile", tlsClientCaFile)
+	}
+
 	cacheMaxAge := os.Getenv("cacheMaxAge")
 	if cacheMaxAge == "" {
 		cacheMaxAge = "5" // default value
@@ -145,13 +179,146 @@ func LoadConfig() *Config {
 	}
 	logging.Info("Env:", "vehicleDataCacheTime", vehicleDataCacheTimeInt)
 
+	maxConcurrentSessions := os.Getenv("maxConcurrentSessions")
+	if maxConcurrentSessions == "" {
+		maxConcurrentSessions = "1" // default value: one connection at a time
+	}
+	maxConcurrentSessionsInt, err := strconv.Atoi(maxConcurrentSessions)
+	if err != nil || maxConcurrentSessionsInt < 1 {
+		logging.Error("Invalid maxConcurrentSessions value, using default (1)", "error", err)
+		maxConcurrentSessionsInt = 1
+	}
+	logging.Info("Env:", "maxConcurrentSessions", maxConcurrentSessionsInt)
+
+	keepAlive := os.Getenv("keepAlive") == "true"
+	logging.Info("Env:", "keepAlive", keepAlive)
+
+	keepAliveInterval := os.Getenv("keepAliveInterval")
+	if keepAliveInterval == "" {
+		keepAliveInterval = "30" // default value: 30 seconds
+	}
+	keepAliveIntervalInt, err := strconv.Atoi(keepAliveInterval)
+	if err != nil || keepAliveIntervalInt < 1 {
+		logging.Error("Invalid keepAliveInterval value, using default (30)", "error", err)
+		keepAliveIntervalInt = 30
+	}
+	logging.Info("Env:", "keepAliveInterval", keepAliveIntervalInt)
+
+	commandTtlHigh := loadCommandTtl("commandTtlHigh", 300)
+	commandTtlNormal := loadCommandTtl("commandTtlNormal", 60)
+	commandTtlLow := loadCommandTtl("commandTtlLow", 30)
+
+	pollVins := splitList(os.Getenv("pollVins"))
+	logging.Info("Env:", "pollVins", pollVins)
+
+	pollEndpoints := splitList(os.Getenv("pollEndpoints"))
+	if len(pollEndpoints) == 0 {
+		pollEndpoints = []string{"charge_state"} // default value
+	}
+	logging.Info("Env:", "pollEndpoints", pollEndpoints)
+
+	pollIntervalState := loadPollInterval("pollIntervalState", 60)
+	pollIntervalCharging := loadPollInterval("pollIntervalCharging", 30)
+	pollIntervalIdle := loadPollInterval("pollIntervalIdle", 900)
+
+	mqttBroker := os.Getenv("mqttBroker")
+	logging.Info("Env:", "mqttBroker", mqttBroker)
+
+	mqttClientId := os.Getenv("mqttClientId")
+	if mqttClientId == "" {
+		mqttClientId = "TeslaBleHttpProxy" // default value
+	}
+
+	mqttTopicPrefix := strings.Trim(os.Getenv("mqttTopicPrefix"), "/")
+	if mqttTopicPrefix == "" {
+		mqttTopicPrefix = "tesla-ble" // default value
+	}
+
+	mqttDiscovery := os.Getenv("mqttDiscovery") != "false"
+	mqttDiscoveryPrefix := strings.Trim(os.Getenv("mqttDiscoveryPrefix"), "/")
+	if mqttDiscoveryPrefix == "" {
+		mqttDiscoveryPrefix = "homeassistant" // default value
+	}
+	// Everyone who can publish to the broker can send commands, so unlocking and driving are not accepted by default
+	mqttScopes := splitList(os.Getenv("mqttScopes"))
+	if len(mqttScopes) == 0 {
+		mqttScopes = []string{"read", "charge", "climate"} // default value
+	}
+	if mqttBroker != "" {
+		logging.Info("Env:", "mqttClientId", mqttClientId, "mqttTopicPrefix", mqttTopicPrefix, "mqttDiscovery", mqttDiscovery, "mqttDiscoveryPrefix", mqttDiscoveryPrefix, "mqttScopes", mqttScopes)
+	}
+
 	return &Config{
-		LogLevel:             envLogLevel,
-		HttpListenAddress:    addr,
-		CacheMaxAge:          cacheMaxAgeInt,
-		ScanTimeout:          scanTimeoutInt,
-		VehicleDataCacheTime: vehicleDataCacheTimeInt,
+		LogLevel:              envLogLevel,
+		HttpListenAddress:     addr,
+		TlsEnabled:            tlsEnabled,
+		TlsCertFile:           tlsCertFile,
+		TlsKeyFile:            tlsKeyFile,
+		TlsClientCaFile:       tlsClientCaFile,
+		CacheMaxAge:           cacheMaxAgeInt,
+		ScanTimeout:           scanTimeoutInt,
+		VehicleDataCacheTime:  vehicleDataCacheTimeInt,
+		MaxConcurrentSessions: maxConcurrentSessionsInt,
+		KeepAlive:             keepAlive,
+		KeepAliveInterval:     keepAliveIntervalInt,
+		CommandTtlHigh:        commandTtlHigh,
+		CommandTtlNormal:      commandTtlNormal,
+		CommandTtlLow:         commandTtlLow,
+		PollVins:              pollVins,
+		PollEndpoints:         pollEndpoints,
+		PollIntervalState:     pollIntervalState,
+		PollIntervalCharging:  pollIntervalCharging,
+		PollIntervalIdle:      pollIntervalIdle,
+		MqttBroker:            mqttBroker,
+		MqttUsername:          os.Getenv("mqttUsername"),
+		MqttPassword:          os.Getenv("mqttPassword"),
+		MqttClientId:          mqttClientId,
+		MqttTopicPrefix:       mqttTopicPrefix,
+		MqttDiscovery:         mqttDiscovery,
+		MqttDiscoveryPrefix:   mqttDiscoveryPrefix,
+		MqttScopes:            mqttScopes,
+	}
+}
+
+// loadCommandTtl reads the default time to live of a command class in seconds
+func loadCommandTtl(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		value = strconv.Itoa(defaultValue)
+	}
+	ttl, err := strconv.Atoi(value)
+	if err != nil || ttl < 0 {
+		logging.Error(fmt.Sprintf("Invalid %s value, using default (%d)", name, defaultValue), "error", err)
+		ttl = defaultValue
+	}
+	logging.Info("Env:", name, ttl)
+	return ttl
+}
+
+// loadPollInterval reads a polling interval in seconds
+func loadPollInterval(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		value = strconv.Itoa(defaultValue)
+	}
+	interval, err := strconv.Atoi(value)
+	if err != nil || interval < 1 {
+		logging.Error(fmt.Sprintf("Invalid %s value, using default (%d)", name, defaultValue), "error", err)
+		interval = defaultValue
+	}
+	logging.Info("Env:", name, interval)
+	return interval
+}
+
+// splitList splits a comma separated list and removes empty entries
+func splitList(value string) []string {
+	list := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
 	}
+	return list
 }
 
 func InitConfig() {
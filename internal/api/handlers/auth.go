@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+const authRealm = "TeslaBleHttpProxy"
+
+type tokenContextKey struct{}
+
+// requestToken returns the bearer token of the request
+func requestToken(r *http.Request) (auth.Token, bool) {
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return auth.Token{}, false
+	}
+	return auth.Verify(strings.TrimSpace(secret))
+}
+
+// hasScope returns true if the token of the request grants the scope. While authentication is disabled,
+// only the scopes that do not need a token are granted.
+func hasScope(r *http.Request, scope string) bool {
+	if !auth.Enabled() {
+		return auth.AllowedWithoutToken(scope)
+	}
+	token, ok := r.Context().Value(tokenContextKey{}).(auth.Token)
+	return ok && token.HasScope(scope)
+}
+
+// Authorize only passes requests with a token that grants the scope. An empty scope accepts every valid token,
+// the handler has to check the scope itself. Authentication is disabled until the first token is created or
+// the dashboard password is set, until then the security and admin scopes are rejected.
+func Authorize(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response models.Response
+		if !auth.Enabled() {
+			if scope != "" && !auth.AllowedWithoutToken(scope) {
+				logging.Warn("Request needs an API token", "Scope", scope, "URL", r.URL.Path)
+				response.Reason = fmt.Sprintf("The scope \"%s\" needs an API token. Set the dashboard password and create a token in the dashboard.", scope)
+				response.Status = http.StatusForbidden
+				commonDefer(w, &response)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		token, ok := requestToken(r)
+		if !ok {
+			logging.Warn("Request without valid API token", "Method", r.Method, "URL", r.URL.Path, "RemoteAddr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+			response.Reason = "A valid API token is required."
+			response.Status = http.StatusUnauthorized
+			commonDefer(w, &response)
+			return
+		}
+		if scope != "" && !token.HasScope(scope) {
+			logging.Warn("API token lacks scope", "Token", token.Name, "Scope", scope, "URL", r.URL.Path)
+			response.Reason = fmt.Sprintf("The API token does not grant the scope \"%s\".", scope)
+			response.Status = http.StatusForbidden
+			commonDefer(w, &response)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)))
+	}
+}
+
+// CreateToken shows the dashboard with the secret of the new token right away instead of redirecting,
+// so the secret is never put on the message stack that is shown to the next visitor
+func CreateToken(html fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		secret, token, err := auth.CreateToken(r.FormValue("name"), r.Form["scope"])
+		if err != nil {
+			models.MainMessageStack.Push(models.Message{
+				Title:   "Error",
+				Message: err.Error(),
+				Type:    models.Error,
+			})
+			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+			return
+		}
+
+		p := dashboardParams(r)
+		p.Messages = append(p.Messages, models.Message{
+			Title:   "Success",
+			Message: fmt.Sprintf("Token '%s' created: %s (copy it now, it can not be shown again)", template.HTMLEscapeString(token.Name), secret),
+			Type:    models.Success,
+		})
+		w.Header().Set("Cache-Control", "no-store")
+		if err := Dashboard(w, p, "", html); err != nil {
+			logging.Error("Error showing dashboard", "Error", err)
+		}
+	}
+}
+
+func RevokeToken(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	}()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := auth.RevokeToken(r.FormValue("id")); err != nil {
+		message := err.Error()
+		if errors.Is(err, auth.ErrTokenNotFound) {
+			message = "The token does not exist anymore."
+		}
+		models.MainMessageStack.Push(models.Message{
+			Title:   "Error",
+			Message: message,
+			Type:    models.Error,
+		})
+		return
+	}
+	models.MainMessageStack.Push(models.Message{
+		Title:   "Success",
+		Message: "Token revoked.",
+		Type:    models.Success,
+	})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+)
+
+// Capabilities returns the commands each key role can authorize and the currently active role
+func Capabilities(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "Capabilities")
+
+	var response models.Response
+	response.Command = "capabilities"
+
+	defer commonDefer(w, &response)
+
+	capabilitiesData := map[string]interface{}{
+		"active_role": control.GetActiveKeyRole(),
+		"roles":       control.GetCapabilities(),
+	}
+
+	capabilitiesJson, err := json.Marshal(capabilitiesData)
+	if err != nil {
+		response.Result = false
+		response.Reason = err.Error()
+		response.Status = http.StatusInternalServerError
+		return
+	}
+
+	response.Result = true
+	response.Reason = "The request was successfully processed."
+	response.Response = capabilitiesJson
+}
@@ -9,8 +9,10 @@ import (
 
 	"github.com/wimaha/TeslaBleHttpProxy/config"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/mqtt"
 )
 
 type KeyInfo struct {
@@ -26,48 +28,56 @@ type DashboardParams struct {
 	ShouldGenKeys bool
 	Messages      []models.Message
 	Version       string
+	Tokens        []auth.Token
+	Scopes        []string
+	CsrfToken     string
 }
 
 func ShowDashboard(html fs.FS) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get all available keys
-		availableRoles := control.ListAvailableKeys()
-		activeRole := control.GetActiveKeyRole()
-
-		// Build key info list (exclude legacy - it's automatically migrated)
-		// Charging Manager first as it's recommended for security
-		allRoles := []string{control.KeyRoleChargingManager, control.KeyRoleOwner}
-		keys := make([]KeyInfo, 0)
-
-		for _, role := range allRoles {
-			exists := control.KeyExists(role)
-			keys = append(keys, KeyInfo{
-				Role:        role,
-				DisplayName: control.GetKeyRoleDisplayName(role),
-				IsActive:    role == activeRole,
-				Exists:      exists,
-			})
+		if err := Dashboard(w, dashboardParams(r), "", html); err != nil {
+			logging.Error("Error showing dashboard", "Error", err)
 		}
+	}
+}
 
-		shouldGenKeys := len(availableRoles) == 0
-		messages := models.MainMessageStack.PopAll()
+func dashboardParams(r *http.Request) DashboardParams {
+	// Get all available keys
+	availableRoles := control.ListAvailableKeys()
+	activeRole := control.GetActiveKeyRole()
+
+	// Build key info list (exclude legacy - it's automatically migrated)
+	// Charging Manager first as it's recommended for security
+	allRoles := []string{control.KeyRoleChargingManager, control.KeyRoleOwner}
+	keys := make([]KeyInfo, 0)
+
+	for _, role := range allRoles {
+		exists := control.KeyExists(role)
+		keys = append(keys, KeyInfo{
+			Role:        role,
+			DisplayName: control.GetKeyRoleDisplayName(role),
+			IsActive:    role == activeRole,
+			Exists:      exists,
+		})
+	}
 
-		p := DashboardParams{
-			Keys:          keys,
-			ActiveKeyRole: activeRole,
-			ShouldGenKeys: shouldGenKeys,
-			Messages:      messages,
-			Version:       config.Version,
-		}
-		if err := Dashboard(w, p, "", html); err != nil {
-			logging.Error("Error showing dashboard", "Error", err)
-		}
+	shouldGenKeys := len(availableRoles) == 0
+	messages := models.MainMessageStack.PopAll()
+
+	return DashboardParams{
+		Keys:          keys,
+		ActiveKeyRole: activeRole,
+		ShouldGenKeys: shouldGenKeys,
+		Messages:      messages,
+		Version:       config.Version,
+		Tokens:        auth.ListTokens(),
+		Scopes:        auth.Scopes,
+		CsrfToken:     contextSession(r).CsrfToken,
 	}
 }
 
 func GenKeys(w http.ResponseWriter, r *http.Request) {
-	// Get role from query parameter
-	role := r.URL.Query().Get("role")
+	role := r.PostFormValue("role")
 	if role == "" {
 		role = control.KeyRoleChargingManager // Default to charging_manager (recommended for security)
 	}
@@ -97,6 +107,7 @@ func GenKeys(w http.ResponseWriter, r *http.Request) {
 		}
 
 		control.SetupBleControl()
+		mqtt.UpdateDiscovery()
 		models.MainMessageStack.Push(models.Message{
 			Title:   "Success",
 			Message: fmt.Sprintf("Keys for role '%s' successfully generated and saved.", control.GetKeyRoleDisplayName(role)),
@@ -113,8 +124,7 @@ func GenKeys(w http.ResponseWriter, r *http.Request) {
 }
 
 func RemoveKeys(w http.ResponseWriter, r *http.Request) {
-	// Get role from query parameter
-	role := r.URL.Query().Get("role")
+	role := r.PostFormValue("role")
 
 	// Role is required (legacy keys are automatically migrated)
 	if role == "" {
@@ -198,6 +208,7 @@ func RemoveKeys(w http.ResponseWriter, r *http.Request) {
 
 	control.CloseBleControl()
 	control.SetupBleControl() // Reinitialize with new active key
+	mqtt.UpdateDiscovery()
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 }
 
@@ -322,6 +333,7 @@ func ActivateKey(w http.ResponseWriter, r *http.Request) {
 			// Reinitialize BLE control with new active key
 			control.CloseBleControl()
 			control.SetupBleControl()
+			mqtt.UpdateDiscovery()
 		}
 	}
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
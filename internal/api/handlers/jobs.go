@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+)
+
+// Job returns the state of a queued or finished command
+func Job(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "Job")
+	params := mux.Vars(r)
+	id := params["id"]
+
+	var response models.Response
+	response.Command = "job"
+	response.JobId = id
+
+	defer commonDefer(w, &response)
+
+	if !checkBleControl(&response) {
+		return
+	}
+
+	job, ok := control.BleControlInstance.GetJob(id)
+	if !ok {
+		response.Result = false
+		response.Reason = fmt.Sprintf("The job \"%s\" does not exist.", id)
+		response.Status = http.StatusNotFound
+		return
+	}
+
+	jobJson, err := json.Marshal(job)
+	if err != nil {
+		response.Result = false
+		response.Reason = err.Error()
+		return
+	}
+
+	response.Vin = job.Vin
+	response.Result = true
+	response.Reason = "The request was successfully processed."
+	response.Response = jobJson
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/config"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+const sessionCookie = "tbhp_session"
+
+type sessionContextKey struct{}
+
+type LoginParams struct {
+	Setup             bool // The password is set on the first run
+	CsrfToken         string
+	Error             string
+	MinPasswordLength int
+	Version           string
+}
+
+// requestSession returns the dashboard session of the request
+func requestSession(r *http.Request) (*auth.Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	return auth.GetSession(cookie.Value)
+}
+
+// contextSession returns the session of a request that passed RequireLogin
+func contextSession(r *http.Request) *auth.Session {
+	session, _ := r.Context().Value(sessionContextKey{}).(*auth.Session)
+	return session
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, session *auth.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.Id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// validCsrfToken checks the CSRF token of a form (or of the X-CSRF-Token header of scripts)
+func validCsrfToken(r *http.Request, session *auth.Session) bool {
+	token := r.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = r.PostFormValue("csrf_token")
+	}
+	return session.ValidCsrfToken(token)
+}
+
+// RequireLogin protects the dashboard with the dashboard password. Every request that is not a GET request
+// must carry the CSRF token of the session, so other web pages can not submit the forms of the dashboard.
+func RequireLogin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.PasswordSet() {
+			if r.Method == http.MethodGet {
+				http.Redirect(w, r, "/setup", http.StatusSeeOther)
+			} else {
+				http.Error(w, "The dashboard password is not set.", http.StatusForbidden)
+			}
+			return
+		}
+
+		session, ok := requestSession(r)
+		if !ok || !session.Authenticated {
+			if r.Method == http.MethodGet {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+			} else {
+				http.Error(w, "Login required.", http.StatusUnauthorized)
+			}
+			return
+		}
+		if r.Method != http.MethodGet && !validCsrfToken(r, session) {
+			logging.Warn("Dashboard request with invalid CSRF token", "Method", r.Method, "URL", r.URL.Path, "RemoteAddr", r.RemoteAddr)
+			http.Error(w, "Invalid CSRF token, reload the dashboard and try again.", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
+	}
+}
+
+// visitorSession returns the session of a visitor who has not logged in yet and creates it if necessary
+func visitorSession(w http.ResponseWriter, r *http.Request) *auth.Session {
+	session, ok := requestSession(r)
+	if !ok {
+		session = auth.NewSession()
+		setSessionCookie(w, r, session)
+	}
+	return session
+}
+
+func showLogin(w http.ResponseWriter, session *auth.Session, setup bool, loginError string, html fs.FS) {
+	p := LoginParams{
+		Setup:             setup,
+		CsrfToken:         session.CsrfToken,
+		Error:             loginError,
+		MinPasswordLength: auth.MinPasswordLength,
+		Version:           config.Version,
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if loginError != "" && setup {
+		w.WriteHeader(http.StatusBadRequest)
+	} else if loginError != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	if err := parse("login.html", html).ExecuteTemplate(w, "layout.html", p); err != nil {
+		logging.Error("Error showing login", "Error", err)
+	}
+}
+
+func ShowLogin(html fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.PasswordSet() {
+			http.Redirect(w, r, "/setup", http.StatusSeeOther)
+			return
+		}
+		session := visitorSession(w, r)
+		if session.Authenticated {
+			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+			return
+		}
+		showLogin(w, session, false, "", html)
+	}
+}
+
+func Login(html fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := requestSession(r)
+		if !ok || !validCsrfToken(r, session) {
+			// The session of the login form expired, show a fresh form
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		if err := auth.CheckPassword(r.PostFormValue("password")); err != nil {
+			if !errors.Is(err, auth.ErrWrongPassword) {
+				logging.Error("Failed to check dashboard password", "Error", err)
+			}
+			logging.Warn("Dashboard login failed", "RemoteAddr", r.RemoteAddr)
+			// Slow down guessing
+			time.Sleep(time.Second)
+			showLogin(w, session, false, "Wrong password.", html)
+			return
+		}
+
+		setSessionCookie(w, r, auth.Login(session))
+		logging.Info("Dashboard login", "RemoteAddr", r.RemoteAddr)
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	}
+}
+
+func ShowSetup(html fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auth.PasswordSet() {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		showLogin(w, visitorSession(w, r), true, "", html)
+	}
+}
+
+func Setup(html fs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := requestSession(r)
+		if !ok || !validCsrfToken(r, session) {
+			http.Redirect(w, r, "/setup", http.StatusSeeOther)
+			return
+		}
+
+		password := r.PostFormValue("password")
+		if password != r.PostFormValue("confirm") {
+			showLogin(w, session, true, "The passwords do not match.", html)
+			return
+		}
+		if err := auth.SetPassword(password); err != nil {
+			if errors.Is(err, auth.ErrPasswordSet) {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			showLogin(w, session, true, err.Error(), html)
+			return
+		}
+
+		setSessionCookie(w, r, auth.Login(session))
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	}
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	auth.DeleteSession(contextSession(r).Id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
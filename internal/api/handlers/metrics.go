@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+// vehicleGauge exports a numeric field of a cached vehicle data section
+type vehicleGauge struct {
+	section string
+	field   string
+	desc    *prometheus.Desc
+}
+
+func newVehicleGauge(section string, field string, name string, help string) vehicleGauge {
+	return vehicleGauge{
+		section: section,
+		field:   field,
+		desc:    prometheus.NewDesc("tesla_ble_proxy_vehicle_"+name, help, []string{"vin"}, nil),
+	}
+}
+
+var vehicleGauges = []vehicleGauge{
+	newVehicleGauge("charge_state", "battery_level", "battery_level_percent", "Battery level of the vehicle."),
+	newVehicleGauge("charge_state", "charger_power", "charger_power_kilowatts", "Charger power of the vehicle."),
+	newVehicleGauge("charge_state", "charge_limit_soc", "charge_limit_percent", "Charge limit of the vehicle."),
+	newVehicleGauge("climate_state", "inside_temp", "inside_temperature_celsius", "Inside temperature of the vehicle."),
+}
+
+var queueDepthDesc = prometheus.NewDesc("tesla_ble_proxy_queue_depth", "Number of commands queued for the vehicle.", []string{"vin"}, nil)
+
+// stateCollector reads the queue depths and the cached vehicle data at scrape time
+type stateCollector struct{}
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	for _, gauge := range vehicleGauges {
+		ch <- gauge.desc
+	}
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	if control.BleControlInstance != nil {
+		for _, session := range control.BleControlInstance.GetSessionStatus() {
+			ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(session.QueueDepth), session.Vin)
+		}
+	}
+
+	vehicleDataCacheMux.RLock()
+	defer vehicleDataCacheMux.RUnlock()
+	for cacheKey, cachedEntry := range vehicleDataCache {
+		vin, section, _ := strings.Cut(cacheKey, ":")
+		var fields map[string]interface{}
+		for _, gauge := range vehicleGauges {
+			if gauge.section != section {
+				continue
+			}
+			if fields == nil {
+				if err := json.Unmarshal(cachedEntry.data, &fields); err != nil {
+					logging.Debug("Failed to unmarshal cached VehicleData for metrics", "VIN", vin, "Endpoint", section, "Error", err)
+					break
+				}
+			}
+			// Fields the vehicle did not report (e.g. the charger power while not charging) are left out
+			if value, ok := fields[gauge.field].(float64); ok {
+				ch <- prometheus.MustNewConstMetric(gauge.desc, prometheus.GaugeValue, value, vin)
+			}
+		}
+	}
+}
+
+var registerStateCollector sync.Once
+
+// Metrics serves the proxy and vehicle metrics in the Prometheus text format
+func Metrics() http.Handler {
+	registerStateCollector.Do(func() {
+		prometheus.MustRegister(stateCollector{})
+	})
+	return promhttp.Handler()
+}
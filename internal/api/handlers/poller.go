@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/config"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+type pollState string
+
+const (
+	pollStateUnknown  pollState = "unknown"  // State could not be read, e.g. the vehicle is out of range
+	pollStateAsleep   pollState = "asleep"   // Vehicle is asleep, vehicle data is not fetched
+	pollStateIdle     pollState = "idle"     // Vehicle is awake and not charging
+	pollStateCharging pollState = "charging" // Vehicle is charging
+)
+
+// vehiclePoller keeps the cached vehicle data of one vehicle fresh without keeping the vehicle awake
+type vehiclePoller struct {
+	vin       string
+	endpoints []string
+
+	mu    sync.RWMutex
+	state pollState
+}
+
+// pollers are created once at startup and only read afterwards
+var pollers = make(map[string]*vehiclePoller)
+
+// StartPollers starts a background poller for every vehicle configured in pollVins
+func StartPollers() {
+	endpoints := []string{}
+	for _, endpoint := range commands.ExpandEndpoints(config.AppConfig.PollEndpoints) {
+		if !slices.Contains(commands.ExceptedEndpoints, endpoint) {
+			logging.Warn("Endpoint not supported, not polled", "Endpoint", endpoint)
+			continue
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	// charge_state is always needed to detect charging
+	if !slices.Contains(endpoints, "charge_state") {
+		endpoints = append(endpoints, "charge_state")
+	}
+
+	for _, vin := range config.AppConfig.PollVins {
+		if !control.ValidVin(vin) {
+			logging.Warn("Invalid VIN, not polled", "VIN", vin)
+			continue
+		}
+		poller := &vehiclePoller{
+			vin:       vin,
+			endpoints: endpoints,
+			state:     pollStateUnknown,
+		}
+		pollers[vin] = poller
+		go poller.run()
+		logging.Info("Polling vehicle data in the background", "VIN", vin, "Endpoints", endpoints)
+	}
+}
+
+func (p *vehiclePoller) run() {
+	interval := time.Duration(config.AppConfig.PollIntervalState) * time.Second
+	for {
+		p.poll()
+		time.Sleep(interval)
+	}
+}
+
+func (p *vehiclePoller) getState() pollState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+func (p *vehiclePoller) setState(state pollState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state != state {
+		logging.Debug("Poll state changed", "VIN", p.vin, "State", state, "Previous", p.state)
+	}
+	p.state = state
+}
+
+// poll reads the sleep status and fetches the vehicle data if it is awake and the data is older than the interval of the current state
+func (p *vehiclePoller) poll() {
+	if control.BleControlInstance == nil {
+		p.setState(pollStateUnknown)
+		return
+	}
+
+	sleepStatus, err := p.readSleepStatus()
+	if err != nil {
+		logging.Debug("Failed to read body controller state", "VIN", p.vin, "Error", err)
+		p.setState(pollStateUnknown)
+		return
+	}
+	if strings.Contains(sleepStatus, "ASLEEP") {
+		p.setState(pollStateAsleep)
+		return
+	}
+
+	// Continue with the charging state of the cache, e.g. after the vehicle woke up or another client fetched it
+	chargeState, age := cachedVehicleData(p.vin, "charge_state")
+	state := pollStateIdle
+	if isCharging(chargeState) {
+		state = pollStateCharging
+	}
+	p.setState(state)
+
+	interval := time.Duration(config.AppConfig.PollIntervalIdle) * time.Second
+	if state == pollStateCharging {
+		interval = time.Duration(config.AppConfig.PollIntervalCharging) * time.Second
+	}
+	if chargeState != nil && age < interval {
+		return
+	}
+
+	fetchedData, err := p.fetch()
+	if err != nil {
+		logging.Debug("Failed to poll vehicle data", "VIN", p.vin, "Error", err)
+		return
+	}
+	storeVehicleData(p.vin, fetchedData)
+	if isCharging(fetchedData["charge_state"]) {
+		p.setState(pollStateCharging)
+	} else {
+		p.setState(pollStateIdle)
+	}
+}
+
+// readSleepStatus reads the body controller state, which does not wake the vehicle, and returns the sleep status
+func (p *vehiclePoller) readSleepStatus() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var apiResponse models.ApiResponse
+	wg := sync.WaitGroup{}
+	apiResponse.Wait = &wg
+	apiResponse.Ctx = ctx
+
+	wg.Add(1)
+	if _, err := control.BleControlInstance.PushCommand("body-controller-state", p.vin, nil, &apiResponse, false, commands.PriorityLow, commands.DefaultExpiry(commands.PriorityLow, time.Now())); err != nil {
+		return "", err
+	}
+	wg.Wait()
+
+	if !apiResponse.Result {
+		return "", fmt.Errorf("%s", apiResponse.Error)
+	}
+	var vehicleStatus models.VehicleStatus
+	if err := json.Unmarshal(apiResponse.Response, &vehicleStatus); err != nil {
+		return "", err
+	}
+	recordBodyControllerState(p.vin, apiResponse.Response)
+	return vehicleStatus.VehicleSleepStatus, nil
+}
+
+// fetch fetches the polled endpoints without waking the vehicle
+func (p *vehiclePoller) fetch() (map[string]json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	apiResponse, err := fetchVehicleData(ctx, p.vin, p.endpoints, false, commands.PriorityLow)
+	if err != nil {
+		return nil, err
+	}
+	if !apiResponse.Result {
+		return nil, fmt.Errorf("%s", apiResponse.Error)
+	}
+	var fetchedData map[string]json.RawMessage
+	if err := json.Unmarshal(apiResponse.Response, &fetchedData); err != nil {
+		return nil, err
+	}
+	return fetchedData, nil
+}
+
+// maxAge returns how long the cached endpoint can be served because the poller keeps it fresh, 0 if it is not polled.
+// While the vehicle is asleep, the cached data does not change.
+func (p *vehiclePoller) maxAge(endpoint string) time.Duration {
+	if !slices.Contains(p.endpoints, endpoint) {
+		return 0
+	}
+	stateInterval := time.Duration(config.AppConfig.PollIntervalState) * time.Second
+	switch p.getState() {
+	case pollStateAsleep:
+		return math.MaxInt64
+	case pollStateCharging:
+		return time.Duration(config.AppConfig.PollIntervalCharging)*time.Second + stateInterval
+	case pollStateIdle:
+		return time.Duration(config.AppConfig.PollIntervalIdle)*time.Second + stateInterval
+	}
+	return 0
+}
+
+// polledMaxAge returns how long the cached endpoint of the vehicle can be served because it is polled, 0 if it is not polled
+func polledMaxAge(vin string, endpoint string) time.Duration {
+	if poller, ok := pollers[vin]; ok {
+		return poller.maxAge(endpoint)
+	}
+	return 0
+}
+
+// cachedVehicleData returns the cached endpoint and its age, nil if it is not cached
+func cachedVehicleData(vin string, endpoint string) (json.RawMessage, time.Duration) {
+	vehicleDataCacheMux.RLock()
+	defer vehicleDataCacheMux.RUnlock()
+	cachedEntry, exists := vehicleDataCache[generateVehicleDataCacheKey(vin, endpoint)]
+	if !exists {
+		return nil, 0
+	}
+	return cachedEntry.data, time.Since(cachedEntry.timestamp)
+}
+
+// isCharging returns true if the charge_state reports that the vehicle is charging or starting to charge
+func isCharging(chargeState json.RawMessage) bool {
+	if chargeState == nil {
+		return false
+	}
+	var state models.ChargeState
+	if err := json.Unmarshal(chargeState, &state); err != nil {
+		return false
+	}
+	return state.ChargingState == "Charging" || state.ChargingState == "Starting"
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+)
+
+// Queue returns the command in flight and the pending commands of a vehicle
+func Queue(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "Queue")
+	params := mux.Vars(r)
+	vin := params["vin"]
+
+	var response models.Response
+	response.Vin = vin
+	response.Command = "queue"
+
+	defer commonDefer(w, &response)
+
+	if !checkBleControl(&response) {
+		return
+	}
+
+	queueJson, err := json.Marshal(control.BleControlInstance.GetQueue(vin))
+	if err != nil {
+		response.Result = false
+		response.Reason = err.Error()
+		return
+	}
+
+	response.Result = true
+	response.Reason = "The request was successfully processed."
+	response.Response = queueJson
+}
+
+// FlushQueue cancels all pending commands of a vehicle
+func FlushQueue(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "FlushQueue")
+	params := mux.Vars(r)
+	vin := params["vin"]
+
+	var response models.Response
+	response.Vin = vin
+	response.Command = "flush_queue"
+
+	defer commonDefer(w, &response)
+
+	if !checkBleControl(&response) {
+		return
+	}
+
+	canceled := control.BleControlInstance.FlushQueue(vin)
+
+	response.Result = true
+	response.Reason = fmt.Sprintf("%d queued commands canceled.", canceled)
+	response.Response = json.RawMessage(fmt.Sprintf(`{"canceled":%d}`, canceled))
+}
+
+// CancelQueuedCommand removes a pending command from the queue of a vehicle
+func CancelQueuedCommand(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "CancelQueuedCommand")
+	params := mux.Vars(r)
+	vin := params["vin"]
+	id := params["id"]
+
+	var response models.Response
+	response.Vin = vin
+	response.Command = "cancel"
+	response.JobId = id
+
+	defer commonDefer(w, &response)
+
+	if !checkBleControl(&response) {
+		return
+	}
+
+	if err := control.BleControlInstance.CancelCommand(vin, id); err != nil {
+		response.Result = false
+		switch {
+		case errors.Is(err, control.ErrJobInFlight):
+			response.Reason = fmt.Sprintf("The job \"%s\" is already executed and cannot be canceled.", id)
+			response.Status = http.StatusConflict
+		default:
+			response.Reason = fmt.Sprintf("The job \"%s\" is not queued.", id)
+			response.Status = http.StatusNotFound
+		}
+		return
+	}
+
+	response.Result = true
+	response.Reason = "The command was canceled."
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+)
+
+// Sessions returns the connection state and queue depth of every vehicle
+func Sessions(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "Sessions")
+
+	var response models.Response
+	response.Command = "sessions"
+
+	defer commonDefer(w, &response)
+
+	if !checkBleControl(&response) {
+		return
+	}
+
+	sessionsJson, err := json.Marshal(control.BleControlInstance.GetSessionStatus())
+	if err != nil {
+		response.Result = false
+		response.Reason = err.Error()
+		return
+	}
+
+	response.Result = true
+	response.Reason = "The request was successfully processed."
+	response.Response = sessionsJson
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/events"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+// streamKeepAliveInterval is the interval of the comments that keep idle streams open through proxies
+const streamKeepAliveInterval = 15 * time.Second
+
+// Stream sends the state changes of a vehicle as Server-Sent Events
+func Stream(w http.ResponseWriter, r *http.Request) {
+	logRequest(r, "Stream")
+	params := mux.Vars(r)
+	vin := params["vin"]
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	subscription := events.Subscribe(vin)
+	defer events.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	logging.Debug("Event stream opened", "VIN", vin, "Client", r.RemoteAddr)
+	defer logging.Debug("Event stream closed", "VIN", vin, "Client", r.RemoteAddr)
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-subscription.C:
+			eventJson, err := json.Marshal(event)
+			if err != nil {
+				logging.Error("Failed to marshal event", "Error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, eventJson); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -13,8 +13,11 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/wimaha/TeslaBleHttpProxy/config"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/events"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/metrics"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
 )
 
@@ -31,6 +34,20 @@ var (
 	vehicleDataCacheMux sync.RWMutex
 )
 
+// vehicleDataFetch is a running BLE fetch that identical requests wait for
+type vehicleDataFetch struct {
+	done     chan struct{}
+	response *models.ApiResponse
+	err      error
+}
+
+// vehicleDataFetches holds the running fetches
+// Key format: "VIN:sorted endpoints:wakeup"
+var (
+	vehicleDataFetches    = make(map[string]*vehicleDataFetch)
+	vehicleDataFetchesMux sync.Mutex
+)
+
 func commonDefer(w http.ResponseWriter, response *models.Response) {
 	var ret models.Ret
 	ret.Response = *response
@@ -40,6 +57,9 @@ func commonDefer(w http.ResponseWriter, response *models.Response) {
 	if !response.Result {
 		status = http.StatusServiceUnavailable
 	}
+	if response.Status != 0 {
+		status = response.Status
+	}
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(ret); err != nil {
 		logging.Fatal("failed to send response", "error", err)
@@ -56,6 +76,17 @@ func checkBleControl(response *models.Response) bool {
 	return true
 }
 
+// checkVin rejects VINs that are not 17 uppercase letters and digits
+func checkVin(vin string, response *models.Response) bool {
+	if !control.ValidVin(vin) {
+		response.Reason = fmt.Sprintf("The VIN \"%s\" is invalid, it must consist of 17 uppercase letters and digits.", vin)
+		response.Result = false
+		response.Status = http.StatusBadRequest
+		return false
+	}
+	return true
+}
+
 func Command(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	vin := params["vin"]
@@ -72,7 +103,18 @@ func Command(w http.ResponseWriter, r *http.Request) {
 
 	defer commonDefer(w, &response)
 
-	if !checkBleControl(&response) {
+	if scope := auth.CommandScope(command); !hasScope(r, scope) {
+		logging.Error("Command not allowed for API token", "Command", command, "Scope", scope)
+		response.Reason = fmt.Sprintf("The API token does not grant the scope \"%s\" needed for the command \"%s\".", scope, command)
+		if !auth.Enabled() {
+			response.Reason = fmt.Sprintf("The command \"%s\" needs an API token with the scope \"%s\". Set the dashboard password and create a token in the dashboard.", command, scope)
+		}
+		response.Result = false
+		response.Status = http.StatusForbidden
+		return
+	}
+
+	if !checkBleControl(&response) || !checkVin(vin, &response) {
 		return
 	}
 
@@ -91,6 +133,30 @@ func Command(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	priority, err := getPriority(r, command)
+	if err != nil {
+		response.Reason = err.Error()
+		response.Result = false
+		response.Status = http.StatusBadRequest
+		return
+	}
+
+	expiresAt, err := commands.ParseExpiry(r.URL.Query().Get("ttl"), r.URL.Query().Get("expires_at"), priority, time.Now())
+	if err != nil {
+		response.Reason = err.Error()
+		response.Result = false
+		response.Status = http.StatusBadRequest
+		return
+	}
+
+	if activeRole := control.GetActiveKeyRole(); !control.IsCommandAllowed(activeRole, command) {
+		logging.Error("Command not allowed for active key role", "Command", command, "Role", activeRole)
+		response.Reason = fmt.Sprintf("The command \"%s\" can not be authorized with the active key role '%s'.", command, control.GetKeyRoleDisplayName(activeRole))
+		response.Result = false
+		response.Status = http.StatusForbidden
+		return
+	}
+
 	if wait {
 		var apiResponse models.ApiResponse
 		wg := sync.WaitGroup{}
@@ -98,7 +164,13 @@ func Command(w http.ResponseWriter, r *http.Request) {
 		apiResponse.Ctx = r.Context()
 
 		wg.Add(1)
-		control.BleControlInstance.PushCommand(command, vin, body, &apiResponse, autoWakeup)
+		jobId, err := control.BleControlInstance.PushCommand(command, vin, body, &apiResponse, autoWakeup, priority, expiresAt)
+		response.JobId = jobId
+		if err != nil {
+			response.Result = false
+			response.Reason = err.Error()
+			return
+		}
 
 		wg.Wait()
 
@@ -113,11 +185,115 @@ func Command(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	control.BleControlInstance.PushCommand(command, vin, body, nil, autoWakeup)
+	jobId, err := control.BleControlInstance.PushCommand(command, vin, body, nil, autoWakeup, priority, expiresAt)
+	response.JobId = jobId
+	if err != nil {
+		response.Result = false
+		response.Reason = err.Error()
+		return
+	}
 	response.Result = true
 	response.Reason = "The command was successfully received and will be processed shortly."
 }
 
+// getPriority returns the priority requested with the priority parameter or the default priority of the command
+func getPriority(r *http.Request, command string) (commands.Priority, error) {
+	priorityName := r.URL.Query().Get("priority")
+	if priorityName == "" {
+		return commands.DefaultPriority(command), nil
+	}
+	return commands.ParsePriority(priorityName)
+}
+
+// fetchVehicleData fetches the endpoints from the vehicle. Identical concurrent requests share one fetch.
+func fetchVehicleData(ctx context.Context, vin string, endpoints []string, autoWakeup bool, priority commands.Priority) (*models.ApiResponse, error) {
+	sortedEndpoints := slices.Clone(endpoints)
+	slices.Sort(sortedEndpoints)
+	key := fmt.Sprintf("%s:%s:%t", vin, strings.Join(sortedEndpoints, ";"), autoWakeup)
+
+	vehicleDataFetchesMux.Lock()
+	if fetch, ok := vehicleDataFetches[key]; ok {
+		vehicleDataFetchesMux.Unlock()
+		logging.Debug("Sharing running VehicleData fetch", "VIN", vin, "Endpoints", endpoints)
+		select {
+		case <-fetch.done:
+			return fetch.response, fetch.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	fetch := &vehicleDataFetch{done: make(chan struct{})}
+	vehicleDataFetches[key] = fetch
+	vehicleDataFetchesMux.Unlock()
+
+	defer func() {
+		vehicleDataFetchesMux.Lock()
+		delete(vehicleDataFetches, key)
+		vehicleDataFetchesMux.Unlock()
+		close(fetch.done)
+	}()
+
+	var apiResponse models.ApiResponse
+	wg := sync.WaitGroup{}
+	apiResponse.Wait = &wg
+	apiResponse.Ctx = ctx
+
+	wg.Add(1)
+	if _, err := control.BleControlInstance.PushCommand("vehicle_data", vin, map[string]interface{}{"endpoints": endpoints}, &apiResponse, autoWakeup, priority, commands.DefaultExpiry(priority, time.Now())); err != nil {
+		fetch.err = err
+		return nil, err
+	}
+
+	wg.Wait()
+
+	fetch.response = &apiResponse
+	return fetch.response, nil
+}
+
+// storeVehicleData caches each endpoint separately and publishes the changed fields to the event stream
+func storeVehicleData(vin string, fetchedData map[string]json.RawMessage) {
+	changes := []models.VehicleDataChange{}
+
+	vehicleDataCacheMux.Lock()
+	for endpoint, data := range fetchedData {
+		cacheKey := generateVehicleDataCacheKey(vin, endpoint)
+		var previous json.RawMessage
+		if cachedEntry, exists := vehicleDataCache[cacheKey]; exists {
+			previous = cachedEntry.data
+		}
+		vehicleDataCache[cacheKey] = &vehicleDataCacheEntry{
+			data:      data,
+			timestamp: time.Now(),
+		}
+		logging.Debug("VehicleData endpoint cached", "VIN", vin, "Endpoint", endpoint)
+
+		fieldChanges, err := events.Diff(previous, data)
+		if err != nil {
+			logging.Debug("Failed to diff VehicleData endpoint", "VIN", vin, "Endpoint", endpoint, "Error", err)
+			continue
+		}
+		if len(fieldChanges) > 0 {
+			changes = append(changes, models.VehicleDataChange{Section: endpoint, Changes: fieldChanges, Data: data})
+		}
+	}
+	vehicleDataCacheMux.Unlock()
+
+	for _, change := range changes {
+		events.Publish(events.TypeVehicleData, vin, change)
+	}
+}
+
+// recordBodyControllerState records the sleep status and publishes the changes of the body controller state
+func recordBodyControllerState(vin string, vehicleStatusJson json.RawMessage) {
+	var vehicleStatus models.VehicleStatus
+	if err := json.Unmarshal(vehicleStatusJson, &vehicleStatus); err != nil {
+		logging.Debug("Failed to unmarshal body controller state", "VIN", vin, "Error", err)
+		return
+	}
+	control.BleControlInstance.RecordSleepStatus(vin, vehicleStatus.VehicleSleepStatus)
+	storeVehicleData(vin, map[string]json.RawMessage{models.BodyControllerStateSection: vehicleStatusJson})
+}
+
 // generateVehicleDataCacheKey creates a unique cache key for a specific VIN and endpoint
 func generateVehicleDataCacheKey(vin string, endpoint string) string {
 	return vin + ":" + endpoint
@@ -134,8 +310,10 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 	if endpointsString != "" {
 		endpoints = strings.Split(endpointsString, ";")
 	} else {
-		endpoints = []string{"charge_state", "climate_state"} //'charge_state', 'climate_state', 'closures_state', 'drive_state', 'gui_settings', 'location_data', 'charge_schedule_data', 'preconditioning_schedule_data', 'vehicle_config', 'vehicle_state', 'vehicle_data_combo'
+		// Like the Fleet API, return every supported section if no endpoints are given
+		endpoints = []string{"vehicle_data_combo"}
 	}
+	endpoints = commands.ExpandEndpoints(endpoints)
 
 	var response models.Response
 	response.Vin = vin
@@ -153,11 +331,20 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 
 	defer commonDefer(w, &response)
 
-	if !checkBleControl(&response) {
+	if !checkBleControl(&response) || !checkVin(vin, &response) {
+		return
+	}
+
+	priority, err := getPriority(r, command)
+	if err != nil {
+		response.Reason = err.Error()
+		response.Result = false
+		response.Status = http.StatusBadRequest
 		return
 	}
 
 	cacheTime := time.Duration(config.AppConfig.VehicleDataCacheTime) * time.Second
+	autoWakeup := r.URL.Query().Get("wakeup") == "true"
 
 	// Check cache for each endpoint
 	vehicleDataCacheMux.RLock()
@@ -169,18 +356,22 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 		cachedEntry, exists := vehicleDataCache[cacheKey]
 		if exists {
 			age := time.Since(cachedEntry.timestamp)
-			if age < cacheTime {
+			// Endpoints of polled vehicles are kept fresh in the background (unless the caller wants to wake the vehicle)
+			if age < cacheTime || (!autoWakeup && age < polledMaxAge(vin, endpoint)) {
 				// Cache hit for this endpoint
 				cachedData[endpoint] = cachedEntry.data
+				metrics.VehicleDataCacheRequests.WithLabelValues(endpoint, "hit").Inc()
 				logging.Debug("VehicleData endpoint cache hit", "VIN", vin, "Endpoint", endpoint, "Age", age)
 			} else {
 				// Cache expired for this endpoint
 				logging.Debug("VehicleData endpoint cache expired", "VIN", vin, "Endpoint", endpoint, "Age", age)
+				metrics.VehicleDataCacheRequests.WithLabelValues(endpoint, "miss").Inc()
 				missingEndpoints = append(missingEndpoints, endpoint)
 			}
 		} else {
 			// Cache miss for this endpoint
 			logging.Debug("VehicleData endpoint cache miss", "VIN", vin, "Endpoint", endpoint)
+			metrics.VehicleDataCacheRequests.WithLabelValues(endpoint, "miss").Inc()
 			missingEndpoints = append(missingEndpoints, endpoint)
 		}
 	}
@@ -194,7 +385,7 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 		for _, endpoint := range endpoints {
 			combinedResponse[endpoint] = cachedData[endpoint]
 		}
-		responseJson, err := json.Marshal(combinedResponse)
+		responseJson, err := marshalVehicleData(vin, combinedResponse)
 		if err != nil {
 			response.Result = false
 			response.Reason = fmt.Sprintf("Failed to marshal cached response: %s", err)
@@ -207,16 +398,12 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Some endpoints missing/expired - fetch from BLE
-	var apiResponse models.ApiResponse
-	wg := sync.WaitGroup{}
-	apiResponse.Wait = &wg
-	apiResponse.Ctx = r.Context()
-
-	wg.Add(1)
-	autoWakeup := r.URL.Query().Get("wakeup") == "true"
-	control.BleControlInstance.PushCommand(command, vin, map[string]interface{}{"endpoints": endpoints}, &apiResponse, autoWakeup)
-
-	wg.Wait()
+	apiResponse, err := fetchVehicleData(r.Context(), vin, endpoints, autoWakeup, priority)
+	if err != nil {
+		response.Result = false
+		response.Reason = err.Error()
+		return
+	}
 
 	if apiResponse.Result {
 		// Parse the BLE response to extract individual endpoint data
@@ -227,29 +414,21 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Store each endpoint separately in cache and merge with cached data
-		vehicleDataCacheMux.Lock()
+		// Merge cached endpoints that are still valid with the freshly fetched endpoints
+		// (a coalesced request may have fetched more endpoints than requested)
 		combinedResponse := make(map[string]json.RawMessage)
-
-		// Add cached endpoints that are still valid
 		for endpoint, data := range cachedData {
 			combinedResponse[endpoint] = data
 		}
-
-		// Add freshly fetched endpoints and cache them
 		for endpoint, data := range fetchedData {
-			combinedResponse[endpoint] = data
-			cacheKey := generateVehicleDataCacheKey(vin, endpoint)
-			vehicleDataCache[cacheKey] = &vehicleDataCacheEntry{
-				data:      data,
-				timestamp: time.Now(),
+			if slices.Contains(endpoints, endpoint) {
+				combinedResponse[endpoint] = data
 			}
-			logging.Debug("VehicleData endpoint cached", "VIN", vin, "Endpoint", endpoint)
 		}
-		vehicleDataCacheMux.Unlock()
+		storeVehicleData(vin, fetchedData)
 
 		// Build final response combining cached and fresh data
-		responseJson, err := json.Marshal(combinedResponse)
+		responseJson, err := marshalVehicleData(vin, combinedResponse)
 		if err != nil {
 			response.Result = false
 			response.Reason = fmt.Sprintf("Failed to marshal combined response: %s", err)
@@ -267,7 +446,7 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 			for endpoint, data := range cachedData {
 				combinedResponse[endpoint] = data
 			}
-			responseJson, err := json.Marshal(combinedResponse)
+			responseJson, err := marshalVehicleData(vin, combinedResponse)
 			if err != nil {
 				response.Result = false
 				response.Reason = apiResponse.Error
@@ -283,6 +462,16 @@ func VehicleData(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// marshalVehicleData builds the vehicle_data response like the Fleet API, with the VIN next to the sections
+func marshalVehicleData(vin string, sections map[string]json.RawMessage) (json.RawMessage, error) {
+	vinJson, err := json.Marshal(vin)
+	if err != nil {
+		return nil, err
+	}
+	sections["vin"] = vinJson
+	return json.Marshal(sections)
+}
+
 func BodyControllerState(w http.ResponseWriter, r *http.Request) {
 	logRequest(r, "BodyControllerState")
 	params := mux.Vars(r)
@@ -294,49 +483,48 @@ func BodyControllerState(w http.ResponseWriter, r *http.Request) {
 
 	defer commonDefer(w, &response)
 
-	if !checkBleControl(&response) {
+	if !checkBleControl(&response) || !checkVin(vin, &response) {
 		return
 	}
 
-	var apiResponse models.ApiResponse
+	priority, err := getPriority(r, response.Command)
+	if err != nil {
+		response.Reason = err.Error()
+		response.Result = false
+		response.Status = http.StatusBadRequest
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
-	apiResponse.Ctx = ctx
+	// Queued like every other command, the body controller state is read with a VCSEC-only connection
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
 	defer cancel()
-	cmd := &commands.Command{
-		Command:  "body-controller-state",
-		Domain:   commands.Domain.VCSEC,
-		Vin:      vin,
-		Response: &apiResponse,
-	}
-	conn, car, _, err := control.BleControlInstance.TryConnectToVehicle(ctx, cmd)
-	if err == nil {
-		//Successful
-		defer conn.Close()
-		//defer log.Debug("close connection (A)")
-		defer car.Disconnect()
-		//defer log.Debug("disconnect vehicle (A)")
-
-		_, err, _ := control.BleControlInstance.ExecuteCommand(car, cmd, context.Background())
-		if err != nil {
-			response.Result = false
-			response.Reason = err.Error()
-			return
-		}
 
+	var apiResponse models.ApiResponse
+	wg := sync.WaitGroup{}
+	apiResponse.Wait = &wg
+	apiResponse.Ctx = ctx
+
+	wg.Add(1)
+	jobId, err := control.BleControlInstance.PushCommand(response.Command, vin, nil, &apiResponse, false, priority, commands.DefaultExpiry(priority, time.Now()))
+	response.JobId = jobId
+	if err != nil {
+		response.Result = false
+		response.Reason = err.Error()
+		return
+	}
+
+	wg.Wait()
+
+	if apiResponse.Result {
 		SetCacheControl(w, config.AppConfig.CacheMaxAge)
+		recordBodyControllerState(vin, apiResponse.Response)
 
-		if apiResponse.Result {
-			response.Result = true
-			response.Reason = "The request was successfully processed."
-			response.Response = apiResponse.Response
-		} else {
-			response.Result = false
-			response.Reason = apiResponse.Error
-		}
+		response.Result = true
+		response.Reason = "The request was successfully processed."
+		response.Response = apiResponse.Response
 	} else {
 		response.Result = false
-		response.Reason = err.Error()
+		response.Reason = apiResponse.Error
 	}
 }
 
@@ -345,7 +533,7 @@ func logRequest(r *http.Request, handler string) {
 }
 
 func logRequestWithBody(r *http.Request, handler string, body map[string]interface{}) {
-	logging.Debug("Received HTTP request", "Handler", handler, "Method", r.Method, "Endpoint", r.URL, "Client", r.RemoteAddr, "Body", body)
+	logging.Debug("Received HTTP request", "Handler", handler, "Method", r.Method, "Endpoint", r.URL, "Client", r.RemoteAddr, "Body", commands.RedactBody(body))
 }
 
 func SetCacheControl(w http.ResponseWriter, maxAge int) {
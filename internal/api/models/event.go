@@ -0,0 +1,27 @@
+package models
+
+import "encoding/json"
+
+// FieldChange is the change of a single field. Old is null for new fields, New is null for removed fields.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// BodyControllerStateSection is the section of the body controller state, it is cached like the vehicle data sections
+const BodyControllerStateSection = "body_controller_state"
+
+// VehicleDataChange contains the changed fields of a vehicle data section (e.g. charge_state).
+type VehicleDataChange struct {
+	Section string        `json:"section"`
+	Changes []FieldChange `json:"changes"`
+	// Complete section for in-process subscribers (e.g. MQTT), not sent to stream clients
+	Data json.RawMessage `json:"-"`
+}
+
+// SleepStateChange contains the new and the previous sleep state of a vehicle.
+type SleepStateChange struct {
+	State    string `json:"state"`
+	Previous string `json:"previous,omitempty"`
+}
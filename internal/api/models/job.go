@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// JobStatus contains the state, the error and the timing of a queued command.
+type JobStatus struct {
+	Id         string     `json:"id"`
+	Vin        string     `json:"vin"`
+	Command    string     `json:"command"`
+	State      string     `json:"state"`
+	Error      string     `json:"error,omitempty"`
+	Attempts   int        `json:"attempts"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// QueuedCommand is a command that is waiting in the queue of a vehicle or currently executed.
+type QueuedCommand struct {
+	JobId           string                 `json:"job_id"`
+	CoalescedJobIds []string               `json:"coalesced_job_ids,omitempty"`
+	Command         string                 `json:"command"`
+	Priority        string                 `json:"priority"`
+	Body            map[string]interface{} `json:"body,omitempty"`
+	State           string                 `json:"state"`
+	Attempts        int                    `json:"attempts"`
+	Retries         int                    `json:"retries"`
+	QueuedAt        time.Time              `json:"queued_at"`
+	ExpiresAt       *time.Time             `json:"expires_at,omitempty"`
+}
+
+// QueueStatus contains the command in flight and the pending commands of a vehicle.
+type QueueStatus struct {
+	Vin      string          `json:"vin"`
+	State    string          `json:"state"`
+	InFlight *QueuedCommand  `json:"in_flight,omitempty"`
+	Pending  []QueuedCommand `json:"pending"`
+}
@@ -12,4 +12,7 @@ type Response struct {
 	Vin      string          `json:"vin"`
 	Command  string          `json:"command"`
 	Response json.RawMessage `json:"response,omitempty"`
+	JobId    string          `json:"job_id,omitempty"`
+	// Status overrides the HTTP status code of the response if set
+	Status int `json:"-"`
 }
@@ -0,0 +1,10 @@
+package models
+
+// SessionStatus contains the connection state and queue depth of a vehicle session.
+type SessionStatus struct {
+	Vin           string `json:"vin"`
+	State         string `json:"state"`
+	QueueDepth    int    `json:"queue_depth"`
+	LastConnected int64  `json:"last_connected,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+}
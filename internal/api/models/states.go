@@ -126,3 +126,273 @@ type VehicleStatus struct {
 	VehicleLockState      string                 `json:"vehicle_lock_state"`
 	VehicleSleepStatus    string                 `json:"vehicle_sleep_status"`
 }
+
+// DriveState contains the current drive states available from the vehicle.
+type DriveState struct {
+	Timestamp                      int64    `json:"timestamp"`
+	ShiftState                     string   `json:"shift_state"`
+	Speed                          float32  `json:"speed"`
+	Power                          int32    `json:"power"`
+	Odometer                       float64  `json:"odometer"`
+	ActiveRouteDestination         string   `json:"active_route_destination"`
+	ActiveRouteMinutesToArrival    float32  `json:"active_route_minutes_to_arrival"`
+	ActiveRouteMilesToArrival      float32  `json:"active_route_miles_to_arrival"`
+	ActiveRouteTrafficMinutesDelay float32  `json:"active_route_traffic_minutes_delay"`
+	ActiveRouteEnergyAtArrival     float32  `json:"active_route_energy_at_arrival"`
+	ActiveRouteLatitude            *float32 `json:"active_route_latitude,omitempty"`
+	ActiveRouteLongitude           *float32 `json:"active_route_longitude,omitempty"`
+	// Fleet API drive_state also contains the location. It is only set if the location was fetched.
+	LocationTimestamp int64 `json:"location_timestamp,omitempty"`
+	*Location
+}
+
+// LocationData contains the current location of the vehicle.
+type LocationData struct {
+	Timestamp int64 `json:"timestamp"`
+	Location
+}
+
+// Location contains the location fields shared by location_data and drive_state.
+type Location struct {
+	Latitude                float32 `json:"latitude"`
+	Longitude               float32 `json:"longitude"`
+	Heading                 uint32  `json:"heading"`
+	GpsAsOf                 uint64  `json:"gps_as_of"`
+	NativeLocationSupported int32   `json:"native_location_supported"`
+	NativeLatitude          float32 `json:"native_latitude"`
+	NativeLongitude         float32 `json:"native_longitude"`
+	NativeType              string  `json:"native_type"`
+	CorrectedLatitude       float32 `json:"corrected_latitude"`
+	CorrectedLongitude      float32 `json:"corrected_longitude"`
+	HomelinkNearby          bool    `json:"homelink_nearby"`
+	LocationName            string  `json:"location_name,omitempty"`
+}
+
+// ClosuresState contains the current closure states available from the vehicle.
+// Door and window fields use the Fleet API encoding (0 = closed, 1 = open).
+type ClosuresState struct {
+	Timestamp            int64           `json:"timestamp"`
+	DriverFront          int32           `json:"df"`
+	DriverRear           int32           `json:"dr"`
+	PassengerFront       int32           `json:"pf"`
+	PassengerRear        int32           `json:"pr"`
+	FrontTrunk           int32           `json:"ft"`
+	RearTrunk            int32           `json:"rt"`
+	FrontDriverWindow    int32           `json:"fd_window"`
+	FrontPassengerWindow int32           `json:"fp_window"`
+	RearDriverWindow     int32           `json:"rd_window"`
+	RearPassengerWindow  int32           `json:"rp_window"`
+	SunRoofState         string          `json:"sun_roof_state"`
+	SunRoofPercentOpen   int32           `json:"sun_roof_percent_open"`
+	Locked               bool            `json:"locked"`
+	IsUserPresent        bool            `json:"is_user_present"`
+	CenterDisplayState   string          `json:"center_display_state"`
+	RemoteStart          bool            `json:"remote_start"`
+	ValetMode            bool            `json:"valet_mode"`
+	ValetPinNeeded       bool            `json:"valet_pin_needed"`
+	SentryMode           bool            `json:"sentry_mode"`
+	SentryModeState      string          `json:"sentry_mode_state"`
+	SentryModeAvailable  bool            `json:"sentry_mode_available"`
+	TonneauState         string          `json:"tonneau_state"`
+	TonneauPercentOpen   uint32          `json:"tonneau_percent_open"`
+	TonneauInMotion      bool            `json:"tonneau_in_motion"`
+	SpeedLimitMode       *SpeedLimitMode `json:"speed_limit_mode,omitempty"`
+}
+
+// SpeedLimitMode contains the speed limit settings of the vehicle.
+type SpeedLimitMode struct {
+	Active          bool    `json:"active"`
+	PinCodeSet      bool    `json:"pin_code_set"`
+	MaxLimitMph     float32 `json:"max_limit_mph"`
+	MinLimitMph     float32 `json:"min_limit_mph"`
+	CurrentLimitMph float32 `json:"current_limit_mph"`
+}
+
+// ChargeSchedule contains a single charge schedule stored in the vehicle.
+type ChargeSchedule struct {
+	Id           uint64  `json:"id"`
+	Name         string  `json:"name"`
+	DaysOfWeek   int32   `json:"days_of_week"`
+	StartEnabled bool    `json:"start_enabled"`
+	StartTime    int32   `json:"start_time"`
+	EndEnabled   bool    `json:"end_enabled"`
+	EndTime      int32   `json:"end_time"`
+	OneTime      bool    `json:"one_time"`
+	Enabled      bool    `json:"enabled"`
+	Latitude     float32 `json:"latitude"`
+	Longitude    float32 `json:"longitude"`
+}
+
+// ChargeScheduleState contains the charge schedules available from the vehicle.
+type ChargeScheduleState struct {
+	Timestamp                 int64            `json:"timestamp"`
+	ChargeSchedules           []ChargeSchedule `json:"charge_schedules"`
+	ChargeScheduleWindow      *ChargeSchedule  `json:"charge_schedule_window"`
+	ChargeBuffer              int32            `json:"charge_buffer"`
+	MaxNumChargeSchedules     uint32           `json:"max_num_charge_schedules"`
+	NextSchedule              bool             `json:"next_schedule"`
+	ShowScheduleCompleteValue bool             `json:"show_schedule_complete_value"`
+}
+
+// PreconditionSchedule contains a single precondition schedule stored in the vehicle.
+type PreconditionSchedule struct {
+	Id               uint64  `json:"id"`
+	Name             string  `json:"name"`
+	DaysOfWeek       int32   `json:"days_of_week"`
+	PreconditionTime int32   `json:"precondition_time"`
+	OneTime          bool    `json:"one_time"`
+	Enabled          bool    `json:"enabled"`
+	Latitude         float32 `json:"latitude"`
+	Longitude        float32 `json:"longitude"`
+}
+
+// PreconditioningScheduleState contains the precondition schedules available from the vehicle.
+type PreconditioningScheduleState struct {
+	Timestamp                     int64                  `json:"timestamp"`
+	PreconditionSchedules         []PreconditionSchedule `json:"precondition_schedules"`
+	PreconditioningScheduleWindow *PreconditionSchedule  `json:"preconditioning_schedule_window"`
+	MaxNumPreconditionSchedules   uint32                 `json:"max_num_precondition_schedules"`
+	NextSchedule                  bool                   `json:"next_schedule"`
+}
+
+// TirePressureState contains the current tire pressures available from the vehicle.
+type TirePressureState struct {
+	Timestamp                  int64   `json:"timestamp"`
+	TpmsPressureFl             float32 `json:"tpms_pressure_fl"`
+	TpmsPressureFr             float32 `json:"tpms_pressure_fr"`
+	TpmsPressureRl             float32 `json:"tpms_pressure_rl"`
+	TpmsPressureRr             float32 `json:"tpms_pressure_rr"`
+	TpmsLastSeenPressureTimeFl int64   `json:"tpms_last_seen_pressure_time_fl"`
+	TpmsLastSeenPressureTimeFr int64   `json:"tpms_last_seen_pressure_time_fr"`
+	TpmsLastSeenPressureTimeRl int64   `json:"tpms_last_seen_pressure_time_rl"`
+	TpmsLastSeenPressureTimeRr int64   `json:"tpms_last_seen_pressure_time_rr"`
+	TpmsHardWarningFl          bool    `json:"tpms_hard_warning_fl"`
+	TpmsHardWarningFr          bool    `json:"tpms_hard_warning_fr"`
+	TpmsHardWarningRl          bool    `json:"tpms_hard_warning_rl"`
+	TpmsHardWarningRr          bool    `json:"tpms_hard_warning_rr"`
+	TpmsSoftWarningFl          bool    `json:"tpms_soft_warning_fl"`
+	TpmsSoftWarningFr          bool    `json:"tpms_soft_warning_fr"`
+	TpmsSoftWarningRl          bool    `json:"tpms_soft_warning_rl"`
+	TpmsSoftWarningRr          bool    `json:"tpms_soft_warning_rr"`
+	TpmsRcpFrontValue          float32 `json:"tpms_rcp_front_value"`
+	TpmsRcpRearValue           float32 `json:"tpms_rcp_rear_value"`
+}
+
+// MediaState contains the current media states available from the vehicle.
+type MediaState struct {
+	Timestamp            int64   `json:"timestamp"`
+	RemoteControlEnabled bool    `json:"remote_control_enabled"`
+	NowPlayingArtist     string  `json:"now_playing_artist"`
+	NowPlayingTitle      string  `json:"now_playing_title"`
+	NowPlayingSource     string  `json:"now_playing_source"`
+	MediaPlaybackStatus  string  `json:"media_playback_status"`
+	AudioVolume          float32 `json:"audio_volume"`
+	AudioVolumeIncrement float32 `json:"audio_volume_increment"`
+	AudioVolumeMax       float32 `json:"audio_volume_max"`
+}
+
+// MediaDetailState contains the details of the currently playing media.
+type MediaDetailState struct {
+	Timestamp          int64  `json:"timestamp"`
+	NowPlayingDuration int32  `json:"now_playing_duration"`
+	NowPlayingElapsed  int32  `json:"now_playing_elapsed"`
+	NowPlayingSource   string `json:"now_playing_source_string"`
+	NowPlayingAlbum    string `json:"now_playing_album"`
+	NowPlayingStation  string `json:"now_playing_station"`
+	A2dpSourceName     string `json:"a2dp_source_name"`
+}
+
+// SoftwareUpdateState contains the current software update state of the vehicle.
+type SoftwareUpdateState struct {
+	Timestamp              int64  `json:"timestamp"`
+	Status                 string `json:"status"`
+	Version                string `json:"version"`
+	DownloadPerc           uint32 `json:"download_perc"`
+	InstallPerc            uint32 `json:"install_perc"`
+	ExpectedDurationSec    uint32 `json:"expected_duration_sec"`
+	ScheduledTimeMs        uint64 `json:"scheduled_time_ms"`
+	WarningTimeRemainingMs uint64 `json:"warning_time_remaining_ms"`
+}
+
+// ParentalControlsSettings contains the parental control settings of the vehicle.
+type ParentalControlsSettings struct {
+	SpeedLimitEnabled            bool    `json:"speed_limit_enabled"`
+	MaxLimitMph                  float32 `json:"max_limit_mph"`
+	MinLimitMph                  float32 `json:"min_limit_mph"`
+	CurrentLimitMph              float32 `json:"current_limit_mph"`
+	ChillAccelerationEnabled     bool    `json:"chill_acceleration_enabled"`
+	RequireSafetySettingsEnabled bool    `json:"require_safety_settings_enabled"`
+	CurfewEnabled                bool    `json:"curfew_enabled"`
+	CurfewStartTime              int32   `json:"curfew_start_time"`
+	CurfewEndTime                int32   `json:"curfew_end_time"`
+}
+
+// ParentalControlsState contains the current parental control states of the vehicle.
+type ParentalControlsState struct {
+	Timestamp                int64                     `json:"timestamp"`
+	ParentalControlsActive   bool                      `json:"parental_controls_active"`
+	ParentalControlsPinSet   bool                      `json:"parental_controls_pin_set"`
+	ParentalControlsSettings *ParentalControlsSettings `json:"parental_controls_settings"`
+}
+
+// VehicleState contains the Fleet API vehicle_state composed from the BLE closures, drive,
+// tire pressure and software update states and the body controller state.
+type VehicleState struct {
+	Timestamp                  int64                `json:"timestamp"`
+	Locked                     bool                 `json:"locked"`
+	VehicleLockState           string               `json:"vehicle_lock_state"`
+	VehicleSleepStatus         string               `json:"vehicle_sleep_status"`
+	UserPresence               string               `json:"user_presence"`
+	IsUserPresent              bool                 `json:"is_user_present"`
+	DriverFront                int32                `json:"df"`
+	DriverRear                 int32                `json:"dr"`
+	PassengerFront             int32                `json:"pf"`
+	PassengerRear              int32                `json:"pr"`
+	FrontTrunk                 int32                `json:"ft"`
+	RearTrunk                  int32                `json:"rt"`
+	FrontDriverWindow          int32                `json:"fd_window"`
+	FrontPassengerWindow       int32                `json:"fp_window"`
+	RearDriverWindow           int32                `json:"rd_window"`
+	RearPassengerWindow        int32                `json:"rp_window"`
+	SunRoofState               string               `json:"sun_roof_state"`
+	SunRoofPercentOpen         int32                `json:"sun_roof_percent_open"`
+	TonneauState               string               `json:"tonneau_state"`
+	TonneauPercentOpen         uint32               `json:"tonneau_percent_open"`
+	CenterDisplayState         string               `json:"center_display_state"`
+	RemoteStart                bool                 `json:"remote_start"`
+	SentryMode                 bool                 `json:"sentry_mode"`
+	SentryModeAvailable        bool                 `json:"sentry_mode_available"`
+	ValetMode                  bool                 `json:"valet_mode"`
+	ValetPinNeeded             bool                 `json:"valet_pin_needed"`
+	SpeedLimitMode             *SpeedLimitMode      `json:"speed_limit_mode,omitempty"`
+	Odometer                   float64              `json:"odometer"`
+	SoftwareUpdate             *SoftwareUpdateState `json:"software_update,omitempty"`
+	TpmsPressureFl             float32              `json:"tpms_pressure_fl"`
+	TpmsPressureFr             float32              `json:"tpms_pressure_fr"`
+	TpmsPressureRl             float32              `json:"tpms_pressure_rl"`
+	TpmsPressureRr             float32              `json:"tpms_pressure_rr"`
+	TpmsLastSeenPressureTimeFl int64                `json:"tpms_last_seen_pressure_time_fl"`
+	TpmsLastSeenPressureTimeFr int64                `json:"tpms_last_seen_pressure_time_fr"`
+	TpmsLastSeenPressureTimeRl int64                `json:"tpms_last_seen_pressure_time_rl"`
+	TpmsLastSeenPressureTimeRr int64                `json:"tpms_last_seen_pressure_time_rr"`
+	TpmsHardWarningFl          bool                 `json:"tpms_hard_warning_fl"`
+	TpmsHardWarningFr          bool                 `json:"tpms_hard_warning_fr"`
+	TpmsHardWarningRl          bool                 `json:"tpms_hard_warning_rl"`
+	TpmsHardWarningRr          bool                 `json:"tpms_hard_warning_rr"`
+	TpmsSoftWarningFl          bool                 `json:"tpms_soft_warning_fl"`
+	TpmsSoftWarningFr          bool                 `json:"tpms_soft_warning_fr"`
+	TpmsSoftWarningRl          bool                 `json:"tpms_soft_warning_rl"`
+	TpmsSoftWarningRr          bool                 `json:"tpms_soft_warning_rr"`
+}
+
+// GuiSettings contains the display settings of the vehicle.
+// The vehicle does not report them over BLE, so only the timestamp is set.
+type GuiSettings struct {
+	Timestamp int64 `json:"timestamp"`
+}
+
+// VehicleConfig contains the vehicle configuration that can be derived over BLE.
+type VehicleConfig struct {
+	Timestamp        int64 `json:"timestamp"`
+	SunRoofInstalled bool  `json:"sun_roof_installed"`
+}
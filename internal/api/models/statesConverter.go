@@ -2,6 +2,7 @@ package models
 
 import (
 	"strings"
+	"time"
 
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
@@ -152,3 +153,373 @@ func VehicleStatusFromBle(vs *vcsec.VehicleStatus) VehicleStatus {
 		VehicleSleepStatus:    flatten(vs.GetVehicleSleepStatus().String()),
 	}
 }
+
+func boolToInt(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func DriveStateFromBle(VehicleData *carserver.VehicleData) DriveState {
+	driveState := DriveState{
+		Timestamp:                      VehicleData.DriveState.GetTimestamp().AsTime().Unix(),
+		ShiftState:                     flatten(VehicleData.DriveState.GetShiftState().String()),
+		Speed:                          VehicleData.DriveState.GetSpeedFloat(),
+		Power:                          VehicleData.DriveState.GetPower(),
+		Odometer:                       float64(VehicleData.DriveState.GetOdometerInHundredthsOfAMile()) / 100,
+		ActiveRouteDestination:         VehicleData.DriveState.GetActiveRouteDestination(),
+		ActiveRouteMinutesToArrival:    VehicleData.DriveState.GetActiveRouteMinutesToArrival(),
+		ActiveRouteMilesToArrival:      VehicleData.DriveState.GetActiveRouteMilesToArrival(),
+		ActiveRouteTrafficMinutesDelay: VehicleData.DriveState.GetActiveRouteTrafficMinutesDelay(),
+		ActiveRouteEnergyAtArrival:     VehicleData.DriveState.GetActiveRouteEnergyAtArrival(),
+	}
+	if coordinates := VehicleData.DriveState.GetActiveRouteCoordinates(); coordinates != nil {
+		latitude := coordinates.GetLatitude()
+		longitude := coordinates.GetLongitude()
+		driveState.ActiveRouteLatitude = &latitude
+		driveState.ActiveRouteLongitude = &longitude
+	}
+	return driveState
+}
+
+func ClosuresStateFromBle(VehicleData *carserver.VehicleData) ClosuresState {
+	sentryModeState := flatten(VehicleData.ClosuresState.GetSentryModeState().String())
+	closuresState := ClosuresState{
+		Timestamp:            VehicleData.ClosuresState.GetTimestamp().AsTime().Unix(),
+		DriverFront:          boolToInt(VehicleData.ClosuresState.GetDoorOpenDriverFront()),
+		DriverRear:           boolToInt(VehicleData.ClosuresState.GetDoorOpenDriverRear()),
+		PassengerFront:       boolToInt(VehicleData.ClosuresState.GetDoorOpenPassengerFront()),
+		PassengerRear:        boolToInt(VehicleData.ClosuresState.GetDoorOpenPassengerRear()),
+		FrontTrunk:           boolToInt(VehicleData.ClosuresState.GetDoorOpenTrunkFront()),
+		RearTrunk:            boolToInt(VehicleData.ClosuresState.GetDoorOpenTrunkRear()),
+		FrontDriverWindow:    boolToInt(VehicleData.ClosuresState.GetWindowOpenDriverFront()),
+		FrontPassengerWindow: boolToInt(VehicleData.ClosuresState.GetWindowOpenPassengerFront()),
+		RearDriverWindow:     boolToInt(VehicleData.ClosuresState.GetWindowOpenDriverRear()),
+		RearPassengerWindow:  boolToInt(VehicleData.ClosuresState.GetWindowOpenPassengerRear()),
+		SunRoofState:         flatten(VehicleData.ClosuresState.GetSunRoofState().String()),
+		SunRoofPercentOpen:   VehicleData.ClosuresState.GetSunRoofPercentOpen(),
+		Locked:               VehicleData.ClosuresState.GetLocked(),
+		IsUserPresent:        VehicleData.ClosuresState.GetIsUserPresent(),
+		CenterDisplayState:   flatten(VehicleData.ClosuresState.GetCenterDisplayState().String()),
+		RemoteStart:          VehicleData.ClosuresState.GetRemoteStart(),
+		ValetMode:            VehicleData.ClosuresState.GetValetMode(),
+		ValetPinNeeded:       VehicleData.ClosuresState.GetValetPinNeeded(),
+		SentryMode:           sentryModeState != "" && sentryModeState != "Off",
+		SentryModeState:      sentryModeState,
+		SentryModeAvailable:  VehicleData.ClosuresState.GetSentryModeAvailable(),
+		TonneauState:         flatten(VehicleData.ClosuresState.GetTonneauState().String()),
+		TonneauPercentOpen:   VehicleData.ClosuresState.GetTonneauPercentOpen(),
+		TonneauInMotion:      VehicleData.ClosuresState.GetTonneauInMotion(),
+	}
+	if slm := VehicleData.ClosuresState.GetSpeedLimitMode(); slm != nil {
+		closuresState.SpeedLimitMode = &SpeedLimitMode{
+			Active:          slm.GetActive(),
+			PinCodeSet:      slm.GetPinCodeSet(),
+			MaxLimitMph:     slm.GetMaxLimitMph(),
+			MinLimitMph:     slm.GetMinLimitMph(),
+			CurrentLimitMph: slm.GetCurrentLimitMph(),
+		}
+	}
+	return closuresState
+}
+
+func chargeScheduleFromBle(cs *carserver.ChargeSchedule) ChargeSchedule {
+	return ChargeSchedule{
+		Id:           cs.GetId(),
+		Name:         cs.GetName(),
+		DaysOfWeek:   cs.GetDaysOfWeek(),
+		StartEnabled: cs.GetStartEnabled(),
+		StartTime:    cs.GetStartTime(),
+		EndEnabled:   cs.GetEndEnabled(),
+		EndTime:      cs.GetEndTime(),
+		OneTime:      cs.GetOneTime(),
+		Enabled:      cs.GetEnabled(),
+		Latitude:     cs.GetLatitude(),
+		Longitude:    cs.GetLongitude(),
+	}
+}
+
+func ChargeScheduleStateFromBle(VehicleData *carserver.VehicleData) ChargeScheduleState {
+	schedules := make([]ChargeSchedule, 0, len(VehicleData.ChargeScheduleState.GetChargeSchedules()))
+	for _, schedule := range VehicleData.ChargeScheduleState.GetChargeSchedules() {
+		schedules = append(schedules, chargeScheduleFromBle(schedule))
+	}
+	chargeScheduleState := ChargeScheduleState{
+		Timestamp:                 VehicleData.ChargeScheduleState.GetTimestamp().AsTime().Unix(),
+		ChargeSchedules:           schedules,
+		ChargeBuffer:              VehicleData.ChargeScheduleState.GetChargeBuffer(),
+		MaxNumChargeSchedules:     VehicleData.ChargeScheduleState.GetMaxNumChargeSchedules(),
+		NextSchedule:              VehicleData.ChargeScheduleState.GetNextSchedule(),
+		ShowScheduleCompleteValue: VehicleData.ChargeScheduleState.GetShowScheduleCompleteState(),
+	}
+	if window := VehicleData.ChargeScheduleState.GetChargeScheduleWindow(); window != nil {
+		chargeScheduleWindow := chargeScheduleFromBle(window)
+		chargeScheduleState.ChargeScheduleWindow = &chargeScheduleWindow
+	}
+	return chargeScheduleState
+}
+
+func preconditionScheduleFromBle(ps *carserver.PreconditionSchedule) PreconditionSchedule {
+	return PreconditionSchedule{
+		Id:               ps.GetId(),
+		Name:             ps.GetName(),
+		DaysOfWeek:       ps.GetDaysOfWeek(),
+		PreconditionTime: ps.GetPreconditionTime(),
+		OneTime:          ps.GetOneTime(),
+		Enabled:          ps.GetEnabled(),
+		Latitude:         ps.GetLatitude(),
+		Longitude:        ps.GetLongitude(),
+	}
+}
+
+func PreconditioningScheduleStateFromBle(VehicleData *carserver.VehicleData) PreconditioningScheduleState {
+	schedules := make([]PreconditionSchedule, 0, len(VehicleData.PreconditioningScheduleState.GetPreconditionSchedules()))
+	for _, schedule := range VehicleData.PreconditioningScheduleState.GetPreconditionSchedules() {
+		schedules = append(schedules, preconditionScheduleFromBle(schedule))
+	}
+	preconditioningScheduleState := PreconditioningScheduleState{
+		Timestamp:                   VehicleData.PreconditioningScheduleState.GetTimestamp().AsTime().Unix(),
+		PreconditionSchedules:       schedules,
+		MaxNumPreconditionSchedules: VehicleData.PreconditioningScheduleState.GetMaxNumPreconditionSchedules(),
+		NextSchedule:                VehicleData.PreconditioningScheduleState.GetNextSchedule(),
+	}
+	if window := VehicleData.PreconditioningScheduleState.GetPreconditioningScheduleWindow(); window != nil {
+		preconditioningScheduleWindow := preconditionScheduleFromBle(window)
+		preconditioningScheduleState.PreconditioningScheduleWindow = &preconditioningScheduleWindow
+	}
+	return preconditioningScheduleState
+}
+
+func TirePressureStateFromBle(VehicleData *carserver.VehicleData) TirePressureState {
+	return TirePressureState{
+		Timestamp:                  VehicleData.TirePressureState.GetTimestamp().AsTime().Unix(),
+		TpmsPressureFl:             VehicleData.TirePressureState.GetTpmsPressureFl(),
+		TpmsPressureFr:             VehicleData.TirePressureState.GetTpmsPressureFr(),
+		TpmsPressureRl:             VehicleData.TirePressureState.GetTpmsPressureRl(),
+		TpmsPressureRr:             VehicleData.TirePressureState.GetTpmsPressureRr(),
+		TpmsLastSeenPressureTimeFl: VehicleData.TirePressureState.GetTpmsLastSeenPressureTimeFl().AsTime().Unix(),
+		TpmsLastSeenPressureTimeFr: VehicleData.TirePressureState.GetTpmsLastSeenPressureTimeFr().AsTime().Unix(),
+		TpmsLastSeenPressureTimeRl: VehicleData.TirePressureState.GetTpmsLastSeenPressureTimeRl().AsTime().Unix(),
+		TpmsLastSeenPressureTimeRr: VehicleData.TirePressureState.GetTpmsLastSeenPressureTimeRr().AsTime().Unix(),
+		TpmsHardWarningFl:          VehicleData.TirePressureState.GetTpmsHardWarningFl(),
+		TpmsHardWarningFr:          VehicleData.TirePressureState.GetTpmsHardWarningFr(),
+		TpmsHardWarningRl:          VehicleData.TirePressureState.GetTpmsHardWarningRl(),
+		TpmsHardWarningRr:          VehicleData.TirePressureState.GetTpmsHardWarningRr(),
+		TpmsSoftWarningFl:          VehicleData.TirePressureState.GetTpmsSoftWarningFl(),
+		TpmsSoftWarningFr:          VehicleData.TirePressureState.GetTpmsSoftWarningFr(),
+		TpmsSoftWarningRl:          VehicleData.TirePressureState.GetTpmsSoftWarningRl(),
+		TpmsSoftWarningRr:          VehicleData.TirePressureState.GetTpmsSoftWarningRr(),
+		TpmsRcpFrontValue:          VehicleData.TirePressureState.GetTpmsRcpFrontValue(),
+		TpmsRcpRearValue:           VehicleData.TirePressureState.GetTpmsRcpRearValue(),
+	}
+}
+
+func MediaStateFromBle(VehicleData *carserver.VehicleData) MediaState {
+	return MediaState{
+		Timestamp:            VehicleData.MediaState.GetTimestamp().AsTime().Unix(),
+		RemoteControlEnabled: VehicleData.MediaState.GetRemoteControlEnabled(),
+		NowPlayingArtist:     VehicleData.MediaState.GetNowPlayingArtist(),
+		NowPlayingTitle:      VehicleData.MediaState.GetNowPlayingTitle(),
+		NowPlayingSource:     strings.TrimPrefix(VehicleData.MediaState.GetNowPlayingSource().String(), "MediaSourceType_"),
+		MediaPlaybackStatus:  VehicleData.MediaState.GetMediaPlaybackStatus().String(),
+		AudioVolume:          VehicleData.MediaState.GetAudioVolume(),
+		AudioVolumeIncrement: VehicleData.MediaState.GetAudioVolumeIncrement(),
+		AudioVolumeMax:       VehicleData.MediaState.GetAudioVolumeMax(),
+	}
+}
+
+func MediaDetailStateFromBle(VehicleData *carserver.VehicleData) MediaDetailState {
+	return MediaDetailState{
+		Timestamp:          VehicleData.MediaDetailState.GetTimestamp().AsTime().Unix(),
+		NowPlayingDuration: VehicleData.MediaDetailState.GetNowPlayingDuration(),
+		NowPlayingElapsed:  VehicleData.MediaDetailState.GetNowPlayingElapsed(),
+		NowPlayingSource:   VehicleData.MediaDetailState.GetNowPlayingSourceString(),
+		NowPlayingAlbum:    VehicleData.MediaDetailState.GetNowPlayingAlbum(),
+		NowPlayingStation:  VehicleData.MediaDetailState.GetNowPlayingStation(),
+		A2dpSourceName:     VehicleData.MediaDetailState.GetA2DpSourceName(),
+	}
+}
+
+func SoftwareUpdateStateFromBle(VehicleData *carserver.VehicleData) SoftwareUpdateState {
+	return SoftwareUpdateState{
+		Timestamp:              VehicleData.SoftwareUpdateState.GetTimestamp().AsTime().Unix(),
+		Status:                 flatten(VehicleData.SoftwareUpdateState.GetStatus().String()),
+		Version:                VehicleData.SoftwareUpdateState.GetVersion(),
+		DownloadPerc:           VehicleData.SoftwareUpdateState.GetDownloadPerc(),
+		InstallPerc:            VehicleData.SoftwareUpdateState.GetInstallPerc(),
+		ExpectedDurationSec:    VehicleData.SoftwareUpdateState.GetExpectedDurationSec(),
+		ScheduledTimeMs:        VehicleData.SoftwareUpdateState.GetScheduledTimeMs(),
+		WarningTimeRemainingMs: VehicleData.SoftwareUpdateState.GetWarningTimeRemainingMs(),
+	}
+}
+
+// fleetSoftwareUpdateStatus returns the status names used by the Fleet API ("" if no update is pending).
+func fleetSoftwareUpdateStatus(status *carserver.SoftwareUpdateState_SoftwareUpdateStatus) string {
+	switch status.GetType().(type) {
+	case *carserver.SoftwareUpdateState_SoftwareUpdateStatus_Available:
+		return "available"
+	case *carserver.SoftwareUpdateState_SoftwareUpdateStatus_Scheduled:
+		return "scheduled"
+	case *carserver.SoftwareUpdateState_SoftwareUpdateStatus_Downloading:
+		return "downloading"
+	case *carserver.SoftwareUpdateState_SoftwareUpdateStatus_DownloadingWifiWait:
+		return "downloading_wifi_wait"
+	case *carserver.SoftwareUpdateState_SoftwareUpdateStatus_Installing:
+		return "installing"
+	default:
+		return ""
+	}
+}
+
+// FleetSoftwareUpdateFromBle returns the software update state with the status names of the Fleet API vehicle_state.software_update.
+func FleetSoftwareUpdateFromBle(VehicleData *carserver.VehicleData) SoftwareUpdateState {
+	softwareUpdate := SoftwareUpdateStateFromBle(VehicleData)
+	softwareUpdate.Status = fleetSoftwareUpdateStatus(VehicleData.SoftwareUpdateState.GetStatus())
+	return softwareUpdate
+}
+
+func ParentalControlsStateFromBle(VehicleData *carserver.VehicleData) ParentalControlsState {
+	parentalControlsState := ParentalControlsState{
+		Timestamp:              VehicleData.ParentalControlsState.GetTimestamp().AsTime().Unix(),
+		ParentalControlsActive: VehicleData.ParentalControlsState.GetParentalControlsActive(),
+		ParentalControlsPinSet: VehicleData.ParentalControlsState.GetParentalControlsPinSet(),
+	}
+	if settings := VehicleData.ParentalControlsState.GetParentalControlsSettings(); settings != nil {
+		parentalControlsState.ParentalControlsSettings = &ParentalControlsSettings{
+			SpeedLimitEnabled:            settings.GetSpeedLimitEnabled(),
+			MaxLimitMph:                  settings.GetMaxLimitMph(),
+			MinLimitMph:                  settings.GetMinLimitMph(),
+			CurrentLimitMph:              settings.GetCurrentLimitMph(),
+			ChillAccelerationEnabled:     settings.GetChillAccelerationEnabled(),
+			RequireSafetySettingsEnabled: settings.GetRequireSafetySettingsEnabled(),
+			CurfewEnabled:                settings.GetCurfewEnabled(),
+			CurfewStartTime:              settings.GetCurfewStartTime(),
+			CurfewEndTime:                settings.GetCurfewEndTime(),
+		}
+	}
+	return parentalControlsState
+}
+
+func LocationDataFromBle(VehicleData *carserver.VehicleData) LocationData {
+	return LocationData{
+		Timestamp: VehicleData.LocationState.GetTimestamp().AsTime().Unix(),
+		Location: Location{
+			Latitude:                VehicleData.LocationState.GetLatitude(),
+			Longitude:               VehicleData.LocationState.GetLongitude(),
+			Heading:                 VehicleData.LocationState.GetHeading(),
+			GpsAsOf:                 VehicleData.LocationState.GetGpsAsOf(),
+			NativeLocationSupported: boolToInt(VehicleData.LocationState.GetNativeLocationSupported()),
+			NativeLatitude:          VehicleData.LocationState.GetNativeLatitude(),
+			NativeLongitude:         VehicleData.LocationState.GetNativeLongitude(),
+			NativeType:              strings.ToLower(flatten(VehicleData.LocationState.GetNativeType().String())),
+			CorrectedLatitude:       VehicleData.LocationState.GetCorrectedLatitude(),
+			CorrectedLongitude:      VehicleData.LocationState.GetCorrectedLongitude(),
+			HomelinkNearby:          VehicleData.LocationState.GetHomelinkNearby(),
+			LocationName:            VehicleData.LocationState.GetLocationName(),
+		},
+	}
+}
+
+// FleetDriveStateFromBle returns the drive state including the location like the Fleet API drive_state.
+// The location has its own timestamp, since it is reported separately from the drive state.
+func FleetDriveStateFromBle(VehicleData *carserver.VehicleData) DriveState {
+	driveState := DriveStateFromBle(VehicleData)
+	if VehicleData.LocationState != nil {
+		locationData := LocationDataFromBle(VehicleData)
+		driveState.LocationTimestamp = locationData.Timestamp
+		driveState.Location = &locationData.Location
+	}
+	return driveState
+}
+
+func VehicleStateFromBle(VehicleData *carserver.VehicleData, vs *vcsec.VehicleStatus) VehicleState {
+	closuresState := ClosuresStateFromBle(VehicleData)
+	tirePressureState := TirePressureStateFromBle(VehicleData)
+	vehicleState := VehicleState{
+		Timestamp:                  closuresState.Timestamp,
+		Locked:                     closuresState.Locked,
+		IsUserPresent:              closuresState.IsUserPresent,
+		DriverFront:                closuresState.DriverFront,
+		DriverRear:                 closuresState.DriverRear,
+		PassengerFront:             closuresState.PassengerFront,
+		PassengerRear:              closuresState.PassengerRear,
+		FrontTrunk:                 closuresState.FrontTrunk,
+		RearTrunk:                  closuresState.RearTrunk,
+		FrontDriverWindow:          closuresState.FrontDriverWindow,
+		FrontPassengerWindow:       closuresState.FrontPassengerWindow,
+		RearDriverWindow:           closuresState.RearDriverWindow,
+		RearPassengerWindow:        closuresState.RearPassengerWindow,
+		SunRoofState:               closuresState.SunRoofState,
+		SunRoofPercentOpen:         closuresState.SunRoofPercentOpen,
+		TonneauState:               closuresState.TonneauState,
+		TonneauPercentOpen:         closuresState.TonneauPercentOpen,
+		CenterDisplayState:         closuresState.CenterDisplayState,
+		RemoteStart:                closuresState.RemoteStart,
+		SentryMode:                 closuresState.SentryMode,
+		SentryModeAvailable:        closuresState.SentryModeAvailable,
+		ValetMode:                  closuresState.ValetMode,
+		ValetPinNeeded:             closuresState.ValetPinNeeded,
+		SpeedLimitMode:             closuresState.SpeedLimitMode,
+		Odometer:                   float64(VehicleData.DriveState.GetOdometerInHundredthsOfAMile()) / 100,
+		TpmsPressureFl:             tirePressureState.TpmsPressureFl,
+		TpmsPressureFr:             tirePressureState.TpmsPressureFr,
+		TpmsPressureRl:             tirePressureState.TpmsPressureRl,
+		TpmsPressureRr:             tirePressureState.TpmsPressureRr,
+		TpmsLastSeenPressureTimeFl: tirePressureState.TpmsLastSeenPressureTimeFl,
+		TpmsLastSeenPressureTimeFr: tirePressureState.TpmsLastSeenPressureTimeFr,
+		TpmsLastSeenPressureTimeRl: tirePressureState.TpmsLastSeenPressureTimeRl,
+		TpmsLastSeenPressureTimeRr: tirePressureState.TpmsLastSeenPressureTimeRr,
+		TpmsHardWarningFl:          tirePressureState.TpmsHardWarningFl,
+		TpmsHardWarningFr:          tirePressureState.TpmsHardWarningFr,
+		TpmsHardWarningRl:          tirePressureState.TpmsHardWarningRl,
+		TpmsHardWarningRr:          tirePressureState.TpmsHardWarningRr,
+		TpmsSoftWarningFl:          tirePressureState.TpmsSoftWarningFl,
+		TpmsSoftWarningFr:          tirePressureState.TpmsSoftWarningFr,
+		TpmsSoftWarningRl:          tirePressureState.TpmsSoftWarningRl,
+		TpmsSoftWarningRr:          tirePressureState.TpmsSoftWarningRr,
+	}
+	if VehicleData.SoftwareUpdateState != nil {
+		softwareUpdate := FleetSoftwareUpdateFromBle(VehicleData)
+		vehicleState.SoftwareUpdate = &softwareUpdate
+	}
+
+	// The body controller (VCSEC) is the authoritative source for locks and closures
+	if vs != nil {
+		lockState := vs.GetVehicleLockState()
+		vehicleState.Locked = lockState == vcsec.VehicleLockState_E_VEHICLELOCKSTATE_LOCKED || lockState == vcsec.VehicleLockState_E_VEHICLELOCKSTATE_INTERNAL_LOCKED
+		vehicleState.VehicleLockState = flatten(lockState.String())
+		vehicleState.VehicleSleepStatus = flatten(vs.GetVehicleSleepStatus().String())
+		vehicleState.UserPresence = flatten(vs.GetUserPresence().String())
+		vehicleState.IsUserPresent = vs.GetUserPresence() == vcsec.UserPresence_E_VEHICLE_USER_PRESENCE_PRESENT
+		if cs := vs.GetClosureStatuses(); cs != nil {
+			vehicleState.DriverFront = closureStateToInt(cs.GetFrontDriverDoor())
+			vehicleState.DriverRear = closureStateToInt(cs.GetRearDriverDoor())
+			vehicleState.PassengerFront = closureStateToInt(cs.GetFrontPassengerDoor())
+			vehicleState.PassengerRear = closureStateToInt(cs.GetRearPassengerDoor())
+			vehicleState.FrontTrunk = closureStateToInt(cs.GetFrontTrunk())
+			vehicleState.RearTrunk = closureStateToInt(cs.GetRearTrunk())
+		}
+	}
+	return vehicleState
+}
+
+// closureStateToInt converts a VCSEC closure state to the Fleet API encoding (0 = closed, 1 = open).
+func closureStateToInt(state vcsec.ClosureState_E) int32 {
+	return boolToInt(state != vcsec.ClosureState_E_CLOSURESTATE_CLOSED)
+}
+
+// GuiSettingsFromBle returns the gui settings without units, since the vehicle
+// does not report its display settings over BLE.
+func GuiSettingsFromBle() GuiSettings {
+	return GuiSettings{
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+func VehicleConfigFromBle(VehicleData *carserver.VehicleData) VehicleConfig {
+	return VehicleConfig{
+		Timestamp:        VehicleData.ClosuresState.GetTimestamp().AsTime().Unix(),
+		SunRoofInstalled: VehicleData.ClosuresState.GetSunRoofState() != nil && VehicleData.ClosuresState.GetSunRoofState().GetUnknown() == nil,
+	}
+}
@@ -6,25 +6,42 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/api/handlers"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
 )
 
 func SetupRoutes(static embed.FS, html embed.FS) *mux.Router {
 	router := mux.NewRouter()
 
 	// Define the endpoints
+	// The scope of a command is checked by the command handler
 	///api/1/vehicles/{vehicle_tag}/command/set_charging_amps
-	router.HandleFunc("/api/1/vehicles/{vin}/command/{command}", handlers.Command).Methods("POST")
-	router.HandleFunc("/api/1/vehicles/{vin}/vehicle_data", handlers.VehicleData).Methods("GET")
-	router.HandleFunc("/api/1/vehicles/{vin}/body_controller_state", handlers.BodyControllerState).Methods("GET")
+	router.HandleFunc("/api/1/vehicles/{vin}/command/{command}", handlers.Authorize("", handlers.Command)).Methods("POST")
+	router.HandleFunc("/api/1/vehicles/{vin}/vehicle_data", handlers.Authorize(auth.ScopeRead, handlers.VehicleData)).Methods("GET")
+	router.HandleFunc("/api/1/vehicles/{vin}/body_controller_state", handlers.Authorize(auth.ScopeRead, handlers.BodyControllerState)).Methods("GET")
+	router.HandleFunc("/api/1/vehicles/{vin}/stream", handlers.Authorize(auth.ScopeRead, handlers.Stream)).Methods("GET")
 	router.HandleFunc("/api/proxy/1/version", handlers.Version).Methods("GET")
-	router.HandleFunc("/dashboard", handlers.ShowDashboard(html)).Methods("GET")
-	router.HandleFunc("/logs", handlers.ShowLogViewer(html)).Methods("GET")
-	router.HandleFunc("/api/logs", handlers.GetLogs).Methods("GET")
-	router.HandleFunc("/api/logs/stats", handlers.GetLogStats).Methods("GET")
-	router.HandleFunc("/gen_keys", handlers.GenKeys).Methods("GET")
-	router.HandleFunc("/remove_keys", handlers.RemoveKeys).Methods("GET")
-	router.HandleFunc("/activate_key", handlers.ActivateKey).Methods("POST")
-	router.HandleFunc("/send_key", handlers.SendKey).Methods("POST")
+	router.HandleFunc("/api/proxy/1/capabilities", handlers.Authorize(auth.ScopeRead, handlers.Capabilities)).Methods("GET")
+	router.HandleFunc("/api/proxy/1/sessions", handlers.Authorize(auth.ScopeRead, handlers.Sessions)).Methods("GET")
+	router.HandleFunc("/api/proxy/1/jobs/{id}", handlers.Authorize(auth.ScopeRead, handlers.Job)).Methods("GET")
+	router.HandleFunc("/api/proxy/1/vehicles/{vin}/queue", handlers.Authorize(auth.ScopeRead, handlers.Queue)).Methods("GET")
+	router.HandleFunc("/api/proxy/1/vehicles/{vin}/queue", handlers.Authorize(auth.ScopeAdmin, handlers.FlushQueue)).Methods("DELETE")
+	router.HandleFunc("/api/proxy/1/vehicles/{vin}/queue/{id}", handlers.Authorize(auth.ScopeAdmin, handlers.CancelQueuedCommand)).Methods("DELETE")
+	router.HandleFunc("/metrics", handlers.Authorize(auth.ScopeRead, handlers.Metrics().ServeHTTP)).Methods("GET")
+	router.HandleFunc("/setup", handlers.ShowSetup(html)).Methods("GET")
+	router.HandleFunc("/setup", handlers.Setup(html)).Methods("POST")
+	router.HandleFunc("/login", handlers.ShowLogin(html)).Methods("GET")
+	router.HandleFunc("/login", handlers.Login(html)).Methods("POST")
+	router.HandleFunc("/logout", handlers.RequireLogin(handlers.Logout)).Methods("POST")
+	router.HandleFunc("/dashboard", handlers.RequireLogin(handlers.ShowDashboard(html))).Methods("GET")
+	router.HandleFunc("/logs", handlers.RequireLogin(handlers.ShowLogViewer(html))).Methods("GET")
+	router.HandleFunc("/api/logs", handlers.RequireLogin(handlers.GetLogs)).Methods("GET")
+	router.HandleFunc("/api/logs/stats", handlers.RequireLogin(handlers.GetLogStats)).Methods("GET")
+	router.HandleFunc("/gen_keys", handlers.RequireLogin(handlers.GenKeys)).Methods("POST")
+	router.HandleFunc("/remove_keys", handlers.RequireLogin(handlers.RemoveKeys)).Methods("POST")
+	router.HandleFunc("/activate_key", handlers.RequireLogin(handlers.ActivateKey)).Methods("POST")
+	router.HandleFunc("/send_key", handlers.RequireLogin(handlers.SendKey)).Methods("POST")
+	router.HandleFunc("/create_token", handlers.RequireLogin(handlers.CreateToken(html))).Methods("POST")
+	router.HandleFunc("/revoke_token", handlers.RequireLogin(handlers.RevokeToken)).Methods("POST")
 	router.PathPrefix("/static/").Handler(http.FileServer(http.FS(static)))
 
 	return router
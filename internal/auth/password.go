@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+// PasswordFile stores the hash of the dashboard password
+var PasswordFile = "key/dashboard.json"
+
+// MinPasswordLength is the minimum number of characters of the dashboard password
+const MinPasswordLength = 8
+
+// passwordIterations is the PBKDF2-SHA256 work factor recommended by OWASP
+const passwordIterations = 600000
+
+var (
+	ErrPasswordSet   = errors.New("the dashboard password is already set")
+	ErrWrongPassword = errors.New("wrong password")
+)
+
+type passwordHash struct {
+	Salt       []byte `json:"salt"`
+	Hash       []byte `json:"hash"`
+	Iterations int    `json:"iterations"`
+}
+
+var passwordMu sync.Mutex
+
+// PasswordSet returns true if the dashboard password was set
+func PasswordSet() bool {
+	_, err := os.Stat(PasswordFile)
+	return err == nil
+}
+
+// SetPassword sets the dashboard password on the first run. An existing password is never overwritten.
+func SetPassword(password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return fmt.Errorf("the password must have at least %d characters", MinPasswordLength)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	hash, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, sha256.Size)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	data, err := json.Marshal(passwordHash{Salt: salt, Hash: hash, Iterations: passwordIterations})
+	if err != nil {
+		return fmt.Errorf("failed to marshal password: %w", err)
+	}
+
+	passwordMu.Lock()
+	defer passwordMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(PasswordFile), 0755); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	// O_EXCL makes sure that two visitors of the first run can not both set the password
+	file, err := os.OpenFile(PasswordFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return ErrPasswordSet
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write password: %w", err)
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(PasswordFile)
+		return fmt.Errorf("failed to write password: %w", err)
+	}
+	logging.Info("Dashboard password set")
+	return nil
+}
+
+// CheckPassword returns nil if the password is the dashboard password
+func CheckPassword(password string) error {
+	data, err := os.ReadFile(PasswordFile)
+	if err != nil {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	var stored passwordHash
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to parse password: %w", err)
+	}
+	hash, err := pbkdf2.Key(sha256.New, password, stored.Salt, stored.Iterations, len(stored.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if subtle.ConstantTimeCompare(hash, stored.Hash) != 1 {
+		return ErrWrongPassword
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	ScopeRead     = "read"     // Vehicle data, state, event stream and proxy status
+	ScopeCharge   = "charge"   // Charging commands and wake_up
+	ScopeClimate  = "climate"  // Climate and preconditioning commands
+	ScopeSecurity = "security" // Locks, closures, driving and all other commands
+	ScopeAdmin    = "admin"    // Everything, including queue and token management
+)
+
+// Scopes are all scopes a token can be granted, in the order they are shown
+var Scopes = []string{ScopeRead, ScopeCharge, ScopeClimate, ScopeSecurity, ScopeAdmin}
+
+// readCommands only read the vehicle state
+var readCommands = []string{"vehicle_data", "session_info"}
+
+// chargeCommands are the commands needed to manage charging (e.g. by evcc)
+var chargeCommands = []string{"wake_up", "charge_start", "charge_stop", "set_charging_amps", "set_charge_limit", "charge_port_door_open", "charge_port_door_close", "set_scheduled_charging", "add_charge_schedule", "remove_charge_schedule"}
+
+// climateCommands are the commands that control the climate of the cabin
+var climateCommands = []string{"auto_conditioning_start", "auto_conditioning_stop", "set_temps", "set_preconditioning_max", "remote_seat_heater_request", "remote_seat_cooler_request", "remote_steering_wheel_heater_request", "set_climate_keeper_mode", "set_cabin_overheat_protection", "set_bioweapon_mode", "set_scheduled_departure", "add_precondition_schedule", "remove_precondition_schedule"}
+
+// AllowedWithoutToken returns true if the scope can be used while authentication is not enabled yet.
+// Unlocking the vehicle and managing the proxy always need a token.
+func AllowedWithoutToken(scope string) bool {
+	return scope != ScopeSecurity && scope != ScopeAdmin
+}
+
+// CommandScope returns the scope a token needs to send the command.
+// Commands that are not known to be harmless need the security scope.
+func CommandScope(command string) string {
+	switch {
+	case slices.Contains(readCommands, command):
+		return ScopeRead
+	case slices.Contains(chargeCommands, command):
+		return ScopeCharge
+	case slices.Contains(climateCommands, command):
+		return ScopeClimate
+	default:
+		return ScopeSecurity
+	}
+}
+
+// ValidateScopes returns an error if a scope is unknown or no scope is given
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("invalid scope: %s", scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionLifetime is the time after which a logged in dashboard session has to log in again
+	SessionLifetime = 12 * time.Hour
+	// anonymousSessionLifetime is the time a visitor has to submit the login form
+	anonymousSessionLifetime = 15 * time.Minute
+	// maxSessions limits the memory used by sessions of visitors who never log in
+	maxSessions = 1000
+)
+
+// Session is a dashboard session. Every session has its own CSRF token, including the session
+// of a visitor who has not logged in yet, so the login form is protected as well.
+type Session struct {
+	Id            string
+	CsrfToken     string
+	Authenticated bool
+	expires       time.Time
+}
+
+// ValidCsrfToken compares the token of a submitted form in constant time
+func (s *Session) ValidCsrfToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.CsrfToken)) == 1
+}
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = make(map[string]*Session)
+)
+
+// NewSession creates a session of a visitor who has not logged in yet
+func NewSession() *Session {
+	return addSession(false, anonymousSessionLifetime)
+}
+
+// GetSession returns the session with the id, false if it does not exist or expired
+func GetSession(id string) (*Session, bool) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	session, ok := sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(session.expires) {
+		delete(sessions, id)
+		return nil, false
+	}
+	return session, true
+}
+
+// Login replaces the session of the visitor with a logged in session. The id and the CSRF token
+// change, so a session id that was planted before the login is worthless.
+func Login(session *Session) *Session {
+	DeleteSession(session.Id)
+	return addSession(true, SessionLifetime)
+}
+
+// DeleteSession ends the session
+func DeleteSession(id string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	delete(sessions, id)
+}
+
+func addSession(authenticated bool, lifetime time.Duration) *Session {
+	session := &Session{
+		Id:            randomString(),
+		CsrfToken:     randomString(),
+		Authenticated: authenticated,
+		expires:       time.Now().Add(lifetime),
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if len(sessions) >= maxSessions {
+		pruneSessions()
+	}
+	sessions[session.Id] = session
+	return session
+}
+
+// pruneSessions removes expired sessions and, if there are still too many, the sessions of visitors
+// who did not log in. Must be called with sessionsMu held.
+func pruneSessions() {
+	now := time.Now()
+	for id, session := range sessions {
+		if now.After(session.expires) {
+			delete(sessions, id)
+		}
+	}
+	if len(sessions) < maxSessions {
+		return
+	}
+	for id, session := range sessions {
+		if !session.Authenticated {
+			delete(sessions, id)
+		}
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	// crypto/rand.Read never returns an error
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPassword(t *testing.T) {
+	previous := PasswordFile
+	PasswordFile = filepath.Join(t.TempDir(), "dashboard.json")
+	t.Cleanup(func() {
+		PasswordFile = previous
+	})
+
+	if PasswordSet() {
+		t.Fatal("no password should be set on the first run")
+	}
+	if err := SetPassword("short"); err == nil {
+		t.Error("a short password should be rejected")
+	}
+	if err := SetPassword("correct horse"); err != nil {
+		t.Fatalf("set password failed: %s", err)
+	}
+	if err := SetPassword("battery staple"); err != ErrPasswordSet {
+		t.Errorf("expected the password not to be overwritten, got %v", err)
+	}
+	if err := CheckPassword("correct horse"); err != nil {
+		t.Errorf("expected the password to be accepted, got %v", err)
+	}
+	if err := CheckPassword("battery staple"); err != ErrWrongPassword {
+		t.Errorf("expected %v, got %v", ErrWrongPassword, err)
+	}
+}
+
+func TestSessionLogin(t *testing.T) {
+	visitor := NewSession()
+	if visitor.Authenticated {
+		t.Fatal("a new session should not be logged in")
+	}
+	if !visitor.ValidCsrfToken(visitor.CsrfToken) || visitor.ValidCsrfToken("") || visitor.ValidCsrfToken("forged") {
+		t.Error("only the CSRF token of the session should be valid")
+	}
+
+	session := Login(visitor)
+	if !session.Authenticated || session.Id == visitor.Id || session.CsrfToken == visitor.CsrfToken {
+		t.Error("the login should create a new session with a new CSRF token")
+	}
+	if _, ok := GetSession(visitor.Id); ok {
+		t.Error("the session of the visitor should be ended by the login")
+	}
+	if got, ok := GetSession(session.Id); !ok || got != session {
+		t.Error("the logged in session should exist")
+	}
+
+	DeleteSession(session.Id)
+	if _, ok := GetSession(session.Id); ok {
+		t.Error("a deleted session should not exist")
+	}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+// TokensFile stores the hashed API tokens
+var TokensFile = "key/tokens.json"
+
+// tokenPrefix makes the tokens of the proxy recognizable, e.g. for secret scanners
+const tokenPrefix = "tbhp_"
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// Token is an API token. Only the SHA-256 hash of the secret is stored.
+type Token struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+// HasScope returns true if the token grants the scope. The admin scope grants all scopes.
+func (t *Token) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, ScopeAdmin) || slices.Contains(t.Scopes, scope)
+}
+
+var (
+	tokensMu sync.RWMutex
+	tokens   []Token
+)
+
+// LoadTokens reads the tokens file. A missing file means that no token was created yet.
+func LoadTokens() error {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	data, err := os.ReadFile(TokensFile)
+	if errors.Is(err, os.ErrNotExist) {
+		tokens = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tokens: %w", err)
+	}
+	var loaded []Token
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to parse tokens: %w", err)
+	}
+	tokens = loaded
+	return nil
+}
+
+// Enabled returns true if API authentication is enforced, which is the case as soon as a token exists
+// or the dashboard password is set
+func Enabled() bool {
+	tokensMu.RLock()
+	hasTokens := len(tokens) > 0
+	tokensMu.RUnlock()
+	return hasTokens || PasswordSet()
+}
+
+// ListTokens returns all tokens ordered by creation
+func ListTokens() []Token {
+	tokensMu.RLock()
+	defer tokensMu.RUnlock()
+	return slices.Clone(tokens)
+}
+
+// CreateToken creates a token and returns its secret, which is not stored and can not be shown again
+func CreateToken(name string, scopes []string) (string, Token, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", Token{}, fmt.Errorf("a name is required")
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return "", Token{}, err
+	}
+
+	secretBytes := make([]byte, 32)
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", Token{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", Token{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(secretBytes)
+	token := Token{
+		Id:      hex.EncodeToString(idBytes),
+		Name:    name,
+		Hash:    hashSecret(secret),
+		Scopes:  slices.Clone(scopes),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	updated := append(slices.Clone(tokens), token)
+	if err := saveTokens(updated); err != nil {
+		return "", Token{}, err
+	}
+	tokens = updated
+	logging.Info("API token created", "Id", token.Id, "Name", token.Name, "Scopes", token.Scopes)
+	return secret, token, nil
+}
+
+// RevokeToken deletes the token with the id
+func RevokeToken(id string) error {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	i := slices.IndexFunc(tokens, func(token Token) bool {
+		return token.Id == id
+	})
+	if i < 0 {
+		return ErrTokenNotFound
+	}
+	updated := slices.Delete(slices.Clone(tokens), i, i+1)
+	if err := saveTokens(updated); err != nil {
+		return err
+	}
+	logging.Info("API token revoked", "Id", id, "Name", tokens[i].Name)
+	tokens = updated
+	return nil
+}
+
+// Verify returns the token of the secret, false if the secret is not valid
+func Verify(secret string) (Token, bool) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return Token{}, false
+	}
+	hash := []byte(hashSecret(secret))
+
+	tokensMu.RLock()
+	defer tokensMu.RUnlock()
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(token.Hash)) == 1 {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// saveTokens writes the tokens file, must be called with tokensMu held
+func saveTokens(tokens []Token) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tokens: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(TokensFile), 0755); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	// Written to a temporary file first, so a crash does not leave a truncated file that locks everyone out
+	tmpFile := TokensFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write tokens: %w", err)
+	}
+	if err := os.Rename(tmpFile, TokensFile); err != nil {
+		return fmt.Errorf("failed to write tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useTokensFile(t *testing.T) {
+	t.Helper()
+	previous, previousPassword := TokensFile, PasswordFile
+	TokensFile = filepath.Join(t.TempDir(), "tokens.json")
+	PasswordFile = filepath.Join(t.TempDir(), "dashboard.json")
+	tokens = nil
+	t.Cleanup(func() {
+		TokensFile, PasswordFile = previous, previousPassword
+		tokens = nil
+	})
+}
+
+func TestTokens(t *testing.T) {
+	useTokensFile(t)
+
+	if Enabled() {
+		t.Fatal("authentication should be disabled without tokens")
+	}
+	if _, _, err := CreateToken("evcc", []string{"unlock"}); err == nil {
+		t.Error("a token with an unknown scope should be rejected")
+	}
+
+	adminSecret, admin, err := CreateToken("admin", []string{ScopeAdmin})
+	if err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	evccSecret, evcc, err := CreateToken("evcc", []string{ScopeRead, ScopeCharge})
+	if err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	if !Enabled() {
+		t.Error("authentication should be enabled with tokens")
+	}
+
+	data, err := os.ReadFile(TokensFile)
+	if err != nil {
+		t.Fatalf("tokens file not written: %s", err)
+	}
+	if strings.Contains(string(data), adminSecret) || strings.Contains(string(data), evccSecret) {
+		t.Error("the tokens file must not contain the secrets")
+	}
+
+	// The stored tokens survive a restart
+	tokens = nil
+	if err := LoadTokens(); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	token, ok := Verify(evccSecret)
+	if !ok || token.Id != evcc.Id {
+		t.Fatalf("expected the evcc token to be valid, got %v", token)
+	}
+	if !token.HasScope(ScopeCharge) || token.HasScope(ScopeSecurity) {
+		t.Errorf("unexpected scopes %v", token.Scopes)
+	}
+	if token, _ := Verify(adminSecret); !token.HasScope(ScopeSecurity) {
+		t.Error("the admin scope should grant all scopes")
+	}
+	if _, ok := Verify(evccSecret + "x"); ok {
+		t.Error("a wrong secret should be rejected")
+	}
+
+	if err := RevokeToken(evcc.Id); err != nil {
+		t.Fatalf("revoke failed: %s", err)
+	}
+	if _, ok := Verify(evccSecret); ok {
+		t.Error("a revoked token should be rejected")
+	}
+	if err := RevokeToken(evcc.Id); err != ErrTokenNotFound {
+		t.Errorf("expected %v, got %v", ErrTokenNotFound, err)
+	}
+	if err := RevokeToken(admin.Id); err != nil {
+		t.Fatalf("revoke failed: %s", err)
+	}
+	if Enabled() {
+		t.Error("authentication should be disabled after the last token was revoked")
+	}
+
+	if err := SetPassword("correct horse"); err != nil {
+		t.Fatalf("set password failed: %s", err)
+	}
+	if !Enabled() {
+		t.Error("authentication should be enabled once the dashboard password is set")
+	}
+}
+
+func TestAllowedWithoutToken(t *testing.T) {
+	for _, scope := range []string{ScopeRead, ScopeCharge, ScopeClimate} {
+		if !AllowedWithoutToken(scope) {
+			t.Errorf("%s should be allowed without token", scope)
+		}
+	}
+	for _, scope := range []string{ScopeSecurity, ScopeAdmin} {
+		if AllowedWithoutToken(scope) {
+			t.Errorf("%s should need a token", scope)
+		}
+	}
+}
+
+func TestCommandScope(t *testing.T) {
+	expected := map[string]string{
+		"vehicle_data":            ScopeRead,
+		"set_charging_amps":       ScopeCharge,
+		"wake_up":                 ScopeCharge,
+		"auto_conditioning_start": ScopeClimate,
+		"door_unlock":             ScopeSecurity,
+		"remote_start_drive":      ScopeSecurity,
+		"unknown_command":         ScopeSecurity,
+	}
+	for command, scope := range expected {
+		if got := CommandScope(command); got != scope {
+			t.Errorf("%s: expected scope %s, got %s", command, scope, got)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package control
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -11,38 +13,68 @@ import (
 	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 	"github.com/wimaha/TeslaBleHttpProxy/config"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/events"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/metrics"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
 )
 
 var BleControlInstance *BleControl = nil
 
+// ErrInvalidVin is returned for commands to a VIN that is not 17 uppercase letters and digits
+var ErrInvalidVin = errors.New("invalid VIN")
+
+var vinPattern = regexp.MustCompile(`^[A-Z0-9]{17}$`)
+
+// ValidVin returns true if the VIN consists of 17 uppercase letters and digits
+func ValidVin(vin string) bool {
+	return vinPattern.MatchString(vin)
+}
+
 func SetupBleControl() {
 	var err error
 	if BleControlInstance, err = NewBleControl(); err != nil {
 		logging.Warn("BleControl could not be initialized!")
 	} else {
-		go BleControlInstance.Loop()
 		logging.Info("BleControl initialized")
 	}
 }
 
 func CloseBleControl() {
+	if BleControlInstance != nil {
+		BleControlInstance.Close()
+	}
 	BleControlInstance = nil
 }
 
+type SleepState string
+
+const (
+	SleepStateAwake  SleepState = "awake"
+	SleepStateAsleep SleepState = "asleep"
+)
+
 type BleControl struct {
 	privateKey protocol.ECDHPrivateKey
 
-	commandStack  chan commands.Command
-	providerStack chan commands.Command
+	// One session (connection and command queue) per vehicle
+	sessions   map[string]*vehicleSession
+	sessionsMu sync.Mutex
+	// Limits the number of concurrent BLE connections
+	slots *connectionSlots
+	stop  chan struct{}
+	// State of the queued and finished commands
+	jobs *jobHistory
 
 	// Cache to track when each vehicle was last confirmed awake
 	lastAwakeTime map[string]time.Time
-	awakeTimeMu   sync.RWMutex
+	// Last known sleep state of each vehicle, changes are published to the event stream
+	sleepState  map[string]SleepState
+	awakeTimeMu sync.RWMutex
 }
 
 func NewBleControl() (*BleControl, error) {
@@ -61,44 +93,46 @@ func NewBleControl() (*BleControl, error) {
 
 	return &BleControl{
 		privateKey:    privateKey,
-		commandStack:  make(chan commands.Command, 50),
-		providerStack: make(chan commands.Command),
+		sessions:      make(map[string]*vehicleSession),
+		slots:         newConnectionSlots(config.AppConfig.MaxConcurrentSessions),
+		stop:          make(chan struct{}),
+		jobs:          newJobHistory(),
 		lastAwakeTime: make(map[string]time.Time),
+		sleepState:    make(map[string]SleepState),
 	}, nil
 }
 
-func (bc *BleControl) Loop() {
-	var retryCommand *commands.Command
-	for {
-		time.Sleep(1 * time.Second)
-		if retryCommand != nil {
-			logging.Info("Retrying command", "Command", retryCommand.Command, "Body", retryCommand.Body)
-			retryCommand = bc.connectToVehicleAndOperateConnection(retryCommand)
-		} else {
-			logging.Debug("Waiting for next command ...")
-			// Wait for the next command
-			select {
-			case command, ok := <-bc.providerStack:
-				if ok {
-					retryCommand = bc.connectToVehicleAndOperateConnection(&command)
-				}
-			case command, ok := <-bc.commandStack:
-				if ok {
-					retryCommand = bc.connectToVehicleAndOperateConnection(&command)
-				}
-			}
-		}
-	}
+// Close stops all vehicle sessions. Queued commands are not executed anymore.
+func (bc *BleControl) Close() {
+	close(bc.stop)
 }
 
-func (bc *BleControl) PushCommand(command string, vin string, body map[string]interface{}, response *models.ApiResponse, autoWakeup bool) {
-	bc.commandStack <- commands.Command{
+// PushCommand adds the command to the queue of the vehicle and returns the id of its job.
+// Commands with a higher priority are executed first, commands that are not executed before expiresAt are dropped (zero never expires).
+func (bc *BleControl) PushCommand(command string, vin string, body map[string]interface{}, response *models.ApiResponse, autoWakeup bool, priority commands.Priority, expiresAt time.Time) (string, error) {
+	// Every VIN gets its own session, so only well-formed VINs are accepted
+	if !ValidVin(vin) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidVin, vin)
+	}
+	cmd := &commands.Command{
 		Command:    command,
+		Domain:     commands.CommandDomain(command),
 		Vin:        vin,
 		Body:       body,
 		Response:   response,
 		AutoWakeup: autoWakeup,
+		Priority:   priority,
+		ExpiresAt:  expiresAt,
 	}
+	cmd.JobId = bc.jobs.add(cmd)
+	bc.sessionsMu.Lock()
+	err := bc.getSession(vin).queue.push(cmd)
+	bc.sessionsMu.Unlock()
+	if err != nil {
+		bc.jobs.finish(cmd, err)
+		return cmd.JobId, err
+	}
+	return cmd.JobId, nil
 }
 
 // shouldCheckSleepStatus returns true if we need to check the vehicle's sleep status
@@ -121,10 +155,43 @@ func (bc *BleControl) markVehicleAwake(vin string) {
 	bc.awakeTimeMu.Lock()
 	bc.lastAwakeTime[vin] = time.Now()
 	bc.awakeTimeMu.Unlock()
+	bc.setSleepState(vin, SleepStateAwake)
+}
+
+// markVehicleAsleep records that the vehicle was found asleep, so it is not assumed to be awake anymore
+func (bc *BleControl) markVehicleAsleep(vin string) {
+	bc.awakeTimeMu.Lock()
+	delete(bc.lastAwakeTime, vin)
+	bc.awakeTimeMu.Unlock()
+	bc.setSleepState(vin, SleepStateAsleep)
 }
 
-func (bc *BleControl) connectToVehicleAndOperateConnection(firstCommand *commands.Command) *commands.Command {
-	logging.Info("Connecting to Vehicle ...")
+// setSleepState stores the sleep state and publishes it to the event stream if it changed
+func (bc *BleControl) setSleepState(vin string, state SleepState) {
+	bc.awakeTimeMu.Lock()
+	previous := bc.sleepState[vin]
+	bc.sleepState[vin] = state
+	bc.awakeTimeMu.Unlock()
+
+	if previous != state {
+		logging.Debug("Sleep state changed", "VIN", vin, "State", state, "Previous", previous)
+		events.Publish(events.TypeSleepState, vin, models.SleepStateChange{State: string(state), Previous: string(previous)})
+	}
+}
+
+// RecordSleepStatus records the sleep status read from the body controller (e.g. VEHICLE_SLEEP_STATUS_ASLEEP)
+func (bc *BleControl) RecordSleepStatus(vin string, sleepStatus string) {
+	if strings.Contains(sleepStatus, "ASLEEP") {
+		bc.markVehicleAsleep(vin)
+	} else if strings.Contains(sleepStatus, "AWAKE") {
+		bc.markVehicleAwake(vin)
+	}
+}
+
+func (bc *BleControl) connectToVehicleAndOperateConnection(session *vehicleSession, firstCommand *commands.Command) *commands.Command {
+	logging.Info("Connecting to Vehicle ...", "VIN", firstCommand.Vin)
+	session.setState(SessionStateConnecting)
+	bc.jobs.setState(firstCommand, JobStateConnecting)
 	//defer log.Debug("connecting to Vehicle done")
 
 	var sleep = 3 * time.Second
@@ -132,26 +199,22 @@ func (bc *BleControl) connectToVehicleAndOperateConnection(firstCommand *command
 	var lastErr error
 
 	commandError := func(err error) *commands.Command {
-		logging.Error("Cannot connect to vehicle", "Error", err)
-		if firstCommand.Response != nil {
-			firstCommand.Response.Error = err.Error()
-			firstCommand.Response.Result = false
-			if firstCommand.Response.Wait != nil {
-				firstCommand.Response.Wait.Done()
-			}
-		}
+		logging.Error("Cannot connect to vehicle", "VIN", firstCommand.Vin, "Error", err)
+		session.setLastError(err)
+		bc.jobs.finish(firstCommand, err)
+		firstCommand.Complete(err)
 		return nil
 	}
 
-	var parentCtx context.Context
-	if firstCommand.Response != nil && firstCommand.Response.Ctx != nil {
-		parentCtx = firstCommand.Response.Ctx
+	parentCtx, cancelParent := firstCommand.Context()
+	defer cancelParent()
+	if parentCtx != nil {
 		if parentCtx.Err() != nil {
 			return commandError(parentCtx.Err())
 		}
 	} else {
-		if firstCommand.Response != nil {
-			logging.Warn("No context provided, using default", "Command", firstCommand.Command, "Body", firstCommand.Body)
+		if firstCommand.Response != nil && firstCommand.Response.Ctx == nil {
+			logging.Warn("No context provided, using default", "Command", firstCommand.Command, "Body", commands.RedactBody(firstCommand.Body))
 		}
 		parentCtx = context.Background()
 	}
@@ -166,6 +229,11 @@ func (bc *BleControl) connectToVehicleAndOperateConnection(firstCommand *command
 				return commandError(parentCtx.Err())
 			}
 			sleep *= 2
+			// Do not wake the vehicle for a command that expired while the connection failed
+			if firstCommand.Expired(time.Now()) {
+				bc.expireCommand(firstCommand)
+				return nil
+			}
 		}
 		logging.Debugf("Connecting to vehicle (Attempt %d) ...", i+1)
 		ctx, cancel := context.WithTimeout(parentCtx, 15*time.Second)
@@ -177,7 +245,9 @@ func (bc *BleControl) connectToVehicleAndOperateConnection(firstCommand *command
 			//defer log.Debug("close connection (A)")
 			defer car.Disconnect()
 			//defer log.Debug("disconnect vehicle (A)")
-			cmd := bc.operateConnection(car, firstCommand)
+			session.setState(SessionStateConnected)
+			session.setLastError(nil)
+			cmd := bc.operateConnection(session, car, firstCommand)
 			return cmd
 		} else if !retry || parentCtx.Err() != nil {
 			//Failed but no retry possible - cancel context before returning
@@ -240,12 +310,16 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 	}
 	defer cancelScan()
 
+	scanStart := time.Now()
 	scanResult, err := ble.ScanVehicleBeacon(scanCtx, firstCommand.Vin)
+	metrics.ScanDuration.WithLabelValues(metrics.Result(err)).Observe(time.Since(scanStart).Seconds())
 	if err != nil {
 		if scanCtx.Err() != nil {
 			// Scan timed out - allow retry as vehicle might be temporarily out of range or experiencing transient BLE issues
+			metrics.ConnectFailures.WithLabelValues(metrics.StageScan).Inc()
 			return nil, nil, true, fmt.Errorf("Vehicle is not in range: %s", err)
 		} else {
+			metrics.ConnectFailures.WithLabelValues(metrics.StageConnect).Inc()
 			if strings.Contains(err.Error(), "operation not permitted") {
 				// The underlying BLE package calls HCIDEVDOWN on the BLE device, presumably as a
 				// heavy-handed way of dealing with devices that are in a bad state.
@@ -257,9 +331,17 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 	}
 
 	logging.Debug("Beacon found", "LocalName", scanResult.LocalName, "Address", scanResult.Address, "RSSI", scanResult.RSSI)
+
+	connectStart := time.Now()
+	connectFailed := func(stage string) {
+		metrics.ConnectFailures.WithLabelValues(stage).Inc()
+		metrics.ConnectDuration.WithLabelValues("failure").Observe(time.Since(connectStart).Seconds())
+	}
+
 	//log.Debug("Connecting to vehicle ...")
 	conn, err = ble.NewConnectionFromScanResult(ctx, firstCommand.Vin, scanResult)
 	if err != nil {
+		connectFailed(metrics.StageConnect)
 		return nil, nil, true, fmt.Errorf("failed to connect to vehicle (A): %s", err)
 	}
 
@@ -278,11 +360,13 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 	logging.Debug("Creating vehicle object ...")
 	car, err = vehicle.NewVehicle(conn, bc.privateKey, nil)
 	if err != nil {
+		connectFailed(metrics.StageCreateVehicle)
 		return nil, nil, true, fmt.Errorf("failed to connect to vehicle (B): %s", err)
 	}
 
 	logging.Debug("Connecting ...")
 	if err := car.Connect(ctx); err != nil {
+		connectFailed(metrics.StageConnectVehicle)
 		return nil, nil, true, fmt.Errorf("failed to connect to vehicle (C): %s", err)
 	}
 	//defer car.Disconnect()
@@ -294,6 +378,7 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 		if err := car.StartSession(ctx, []universalmessage.Domain{
 			protocol.DomainVCSEC,
 		}); err != nil {
+			connectFailed(metrics.StageVcsecHandshake)
 			return nil, nil, true, fmt.Errorf("failed to perform handshake with vehicle (A): %s", err)
 		}
 
@@ -323,6 +408,7 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 							if firstCommand.AutoWakeup {
 								logging.Debug("Attempting wakeup since status check failed and AutoWakeup is enabled")
 								if err := car.Wakeup(ctx); err != nil {
+									connectFailed(metrics.StageWakeup)
 									return nil, nil, true, fmt.Errorf("failed to wake up car: %s", err)
 								}
 								logging.Debug("Car wakeup command sent")
@@ -335,9 +421,11 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 							sleepStatus := vs.GetVehicleSleepStatus().String()
 							if strings.Contains(sleepStatus, "ASLEEP") {
 								logging.Debug("Vehicle is asleep")
+								bc.markVehicleAsleep(firstCommand.Vin)
 								if firstCommand.AutoWakeup {
 									logging.Debug("Waking up vehicle as requested ...")
 									if err := car.Wakeup(ctx); err != nil {
+										connectFailed(metrics.StageWakeup)
 										return nil, nil, true, fmt.Errorf("failed to wake up car: %s", err)
 									}
 									logging.Debug("Car successfully wakeup")
@@ -373,6 +461,7 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 					// For commands, always send wakeup (no need to check sleep status first)
 					logging.Debug("Command detected, sending wakeup ...")
 					if err := car.Wakeup(ctx); err != nil {
+						connectFailed(metrics.StageWakeup)
 						return nil, nil, true, fmt.Errorf("failed to wake up car: %s", err)
 					}
 					logging.Debug("Car successfully wakeup")
@@ -386,6 +475,7 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 					protocol.DomainVCSEC,
 					protocol.DomainInfotainment,
 				}); err != nil {
+					connectFailed(metrics.StageInfotainmentHandshake)
 					return nil, nil, true, fmt.Errorf("failed to perform handshake with vehicle (B): %s", err)
 				}
 				logging.Info("Connection to vehicle established")
@@ -396,24 +486,67 @@ func (bc *BleControl) TryConnectToVehicle(ctx context.Context, firstCommand *com
 	}
 
 	// everything fine
+	metrics.ConnectDuration.WithLabelValues("success").Observe(time.Since(connectStart).Seconds())
 	shouldDefer = false
 	return conn, car, false, nil
 }
 
-func (bc *BleControl) operateConnection(car *vehicle.Vehicle, firstCommand *commands.Command) *commands.Command {
+func (bc *BleControl) operateConnection(session *vehicleSession, car *vehicle.Vehicle, firstCommand *commands.Command) *commands.Command {
 	logging.Debug("Operating connection ...")
 	//defer log.Debug("operating connection done")
-	connectionCtx, cancel := context.WithTimeout(context.Background(), 29*time.Second)
+	var connectionCtx context.Context
+	var cancel context.CancelFunc
+	var keepAliveTick <-chan time.Time
+	if config.AppConfig.KeepAlive {
+		// The connection is held open until the vehicle goes to sleep or the link fails
+		connectionCtx, cancel = context.WithCancel(context.Background())
+		ticker := time.NewTicker(time.Duration(config.AppConfig.KeepAliveInterval) * time.Second)
+		defer ticker.Stop()
+		keepAliveTick = ticker.C
+	} else {
+		connectionCtx, cancel = context.WithTimeout(context.Background(), 29*time.Second)
+	}
 	defer cancel()
 
-	cmd, err, _ := bc.ExecuteCommand(car, firstCommand, connectionCtx)
-	if err != nil {
-		return cmd
+	handleCommand := func(command *commands.Command) (doReturn bool, retryCommand *commands.Command, err error) {
+		cmd, err, _ := bc.ExecuteCommand(car, command, connectionCtx)
+
+		// If the connection context is done, return to reoperate the connection
+		if connectionCtx.Err() != nil {
+			return true, cmd, err
+		}
+		// The command is handed back to retry it with a new connection
+		if cmd != nil {
+			return true, cmd, err
+		}
+		// Reconnect if the command failed on every retry, other errors (e.g. an invalid body
+		// or an api context that is done) only concern the command and keep the connection open
+		var connErr *connectionError
+		if errors.As(err, &connErr) {
+			return true, nil, err
+		}
+
+		return false, nil, err
+	}
+
+	// Scanning and connecting can take a while, the command is not sent if it expired in the meantime.
+	// The connection is kept for the other queued commands.
+	var err error
+	if firstCommand.Expired(time.Now()) {
+		bc.expireCommand(firstCommand)
+		err = ErrCommandExpired
+	} else {
+		var doReturn bool
+		var retryCommand *commands.Command
+		if doReturn, retryCommand, err = handleCommand(firstCommand); doReturn {
+			return retryCommand
+		}
 	}
+	session.setInFlight(nil)
 
 	// If wake_up command executed successfully, upgrade session to include Infotainment
 	// for subsequent commands that might need it
-	if firstCommand.Command == "wake_up" {
+	if firstCommand.Command == "wake_up" && err == nil {
 		logging.Debug("Wake_up executed successfully, upgrading session to include Infotainment for subsequent commands")
 		ctx, cancelUpgrade := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancelUpgrade()
@@ -427,62 +560,86 @@ func (bc *BleControl) operateConnection(car *vehicle.Vehicle, firstCommand *comm
 		}
 	}
 
-	handleCommand := func(command *commands.Command) (doReturn bool, retryCommand *commands.Command) {
-		//If new VIN, close connection
-		if command.Vin != firstCommand.Vin {
-			logging.Debug("New VIN, closing connection ...")
-			return true, command
-		}
-
-		cmd, err, ctx := bc.ExecuteCommand(car, command, connectionCtx)
+	// The connection has no infotainment session if it was opened for a VCSEC command
+	vcsecOnly := firstCommand.Domain == commands.Domain.VCSEC
 
-		// If the connection context is done, return to reoperate the connection
+	executedCommands := 1
+	for {
+		// Queued commands are executed with the next connection
 		if connectionCtx.Err() != nil {
-			return true, cmd
+			logging.Debug("Connection timeout ...", "VIN", session.vin)
+			return nil
 		}
-		// If the context is not done, return to retry the command
-		if err != nil && ctx.Err() == nil {
-			return true, cmd
+		// Close the connection if another vehicle is waiting for its turn
+		if session.yieldConnection(executedCommands) {
+			logging.Debug("Other vehicles are waiting, closing connection ...", "VIN", session.vin)
+			return nil
 		}
 
-		// Successful or api context done so no retry
-		return false, nil
-	}
+		if command := session.nextCommand(); command != nil {
+			// The vehicle may be asleep, reconnect with infotainment (and a wakeup) for the command
+			if vcsecOnly && command.Domain != commands.Domain.VCSEC {
+				logging.Debug("Command needs infotainment, reconnecting ...", "VIN", session.vin, "Command", command.Command)
+				return command
+			}
+			executedCommands++
+			session.setInFlight(command)
+			if doReturn, retryCommand, _ := handleCommand(command); doReturn {
+				return retryCommand
+			}
+			session.setInFlight(nil)
+			continue
+		}
 
-	for {
 		select {
 		case <-connectionCtx.Done():
-			logging.Debug("Connection timeout ...")
+			logging.Debug("Connection timeout ...", "VIN", session.vin)
+			return nil
+		case <-bc.stop:
 			return nil
-		case command, ok := <-bc.providerStack:
-			if !ok {
+		case <-keepAliveTick:
+			if !bc.keepAlive(car, session.vin) {
 				return nil
 			}
+		case <-session.queue.notify:
+		case <-time.After(1 * time.Second):
+			// Check regularly if another vehicle is waiting
+		}
+	}
+}
 
-			doReturn, retryCommand := handleCommand(&command)
-			if doReturn {
-				return retryCommand
-			}
-		case command, ok := <-bc.commandStack:
-			if !ok {
-				return nil
-			}
+// keepAlive pings the body controller (VCSEC) without waking the vehicle.
+// Returns false if the connection should be closed because the vehicle is asleep or the link failed.
+func (bc *BleControl) keepAlive(car *vehicle.Vehicle, vin string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-			doReturn, retryCommand := handleCommand(&command)
-			if doReturn {
-				return retryCommand
-			}
-		}
+	vs, err := car.BodyControllerState(ctx)
+	if err != nil {
+		logging.Info("Keep-alive ping failed, closing connection", "VIN", vin, "Error", err)
+		return false
+	}
+	switch vs.GetVehicleSleepStatus() {
+	case vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_ASLEEP:
+		logging.Info("Vehicle is asleep, closing connection", "VIN", vin)
+		bc.markVehicleAsleep(vin)
+		return false
+	case vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_AWAKE:
+		bc.markVehicleAwake(vin)
 	}
+	logging.Debug("Keep-alive ping successful", "VIN", vin, "SleepStatus", vs.GetVehicleSleepStatus().String())
+	return true
 }
 
 func (bc *BleControl) ExecuteCommand(car *vehicle.Vehicle, command *commands.Command, connectionCtx context.Context) (retryCommand *commands.Command, retErr error, ctx context.Context) {
-	logging.Info("Executing command", "Command", command.Command, "Body", command.Body)
-	if command.Response != nil && command.Response.Ctx != nil {
-		ctx = command.Response.Ctx
+	logging.Info("Executing command", "Command", command.Command, "Body", commands.RedactBody(command.Body))
+	parentCtx, cancelParent := command.Context()
+	defer cancelParent()
+	if parentCtx != nil {
+		ctx = parentCtx
 	} else {
-		if command.Response != nil {
-			logging.Debug("No context provided, using default", "Command", command.Command, "Body", command.Body)
+		if command.Response != nil && command.Response.Ctx == nil {
+			logging.Debug("No context provided, using default", "Command", command.Command, "Body", commands.RedactBody(command.Body))
 		}
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
@@ -493,17 +650,15 @@ func (bc *BleControl) ExecuteCommand(car *vehicle.Vehicle, command *commands.Com
 	var retryCount = 3
 	var lastErr error
 
+	start := time.Now()
 	defer func() {
-		if command.Response != nil {
-			if retErr != nil {
-				command.Response.Error = retErr.Error()
-				command.Response.Result = false
-			} else {
-				command.Response.Result = true
-			}
-			if command.Response.Wait != nil && retryCommand == nil {
-				command.Response.Wait.Done()
-			}
+		metrics.CommandDuration.WithLabelValues(command.Command, metrics.Result(retErr)).Observe(time.Since(start).Seconds())
+		// A command that is retried is completed later
+		if retryCommand == nil {
+			bc.jobs.finish(command, retErr)
+			command.Complete(retErr)
+		} else {
+			bc.jobs.setState(command, JobStateRetrying)
 		}
 	}()
 
@@ -529,6 +684,8 @@ func (bc *BleControl) ExecuteCommand(car *vehicle.Vehicle, command *commands.Com
 		if i > 0 {
 			logging.Warn("Retry error", "error", lastErr)
 			logging.Info(fmt.Sprintf("Retrying in %d seconds", sleep/time.Second))
+			bc.jobs.setState(command, JobStateRetrying)
+			metrics.CommandRetries.WithLabelValues(command.Command).Inc()
 
 			select {
 			case <-time.After(sleep):
@@ -541,14 +698,16 @@ func (bc *BleControl) ExecuteCommand(car *vehicle.Vehicle, command *commands.Com
 			sleep *= 2
 		}
 
+		bc.jobs.setState(command, JobStateExecuting)
 		retry, err := command.Send(ctx, car)
 		if err == nil {
-			logging.Info("Successfully executed", "Command", command.Command, "Body", command.Body)
+			logging.Info("Successfully executed", "Command", command.Command, "Body", commands.RedactBody(command.Body))
 			return nil, nil, ctx
 		}
 
 		if !retry {
-			return nil, nil, ctx
+			logging.Error("Failed", "Command", command.Command, "Body", commands.RedactBody(command.Body), "Error", err)
+			return nil, err, ctx
 		}
 
 		if strings.Contains(err.Error(), "closed pipe") {
@@ -558,6 +717,19 @@ func (bc *BleControl) ExecuteCommand(car *vehicle.Vehicle, command *commands.Com
 		lastErr = err
 	}
 
-	logging.Error("Canceled", "Command", command.Command, "Body", command.Body, "Error", lastErr)
-	return nil, lastErr, ctx
+	logging.Error("Canceled", "Command", command.Command, "Body", commands.RedactBody(command.Body), "Error", lastErr)
+	return nil, &connectionError{err: lastErr}, ctx
+}
+
+// connectionError is the error of a command that failed on every retry, the connection is reopened after it
+type connectionError struct {
+	err error
+}
+
+func (e *connectionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connectionError) Unwrap() error {
+	return e.err
 }
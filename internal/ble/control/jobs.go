@@ -0,0 +1,167 @@
+package control
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/events"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+// maxJobHistory is the maximum number of jobs that are kept. The oldest finished jobs are removed first.
+const maxJobHistory = 200
+
+type JobState string
+
+const (
+	JobStateQueued     JobState = "queued"
+	JobStateConnecting JobState = "connecting"
+	JobStateExecuting  JobState = "executing"
+	JobStateRetrying   JobState = "retrying"
+	JobStateSucceeded  JobState = "succeeded"
+	JobStateFailed     JobState = "failed"
+	JobStateCanceled   JobState = "canceled"
+	JobStateExpired    JobState = "expired"
+)
+
+func (s JobState) finished() bool {
+	return s == JobStateSucceeded || s == JobStateFailed || s == JobStateCanceled || s == JobStateExpired
+}
+
+// jobHistory tracks the state of every queued command
+type jobHistory struct {
+	mu    sync.Mutex
+	jobs  map[string]*models.JobStatus
+	order []string
+}
+
+func newJobHistory() *jobHistory {
+	return &jobHistory{
+		jobs: make(map[string]*models.JobStatus),
+	}
+}
+
+func newJobId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms, fall back to the time
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return hex.EncodeToString(b)
+}
+
+// add creates a queued job for the command and returns its id
+func (h *jobHistory) add(command *commands.Command) string {
+	id := newJobId()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job := &models.JobStatus{
+		Id:       id,
+		Vin:      command.Vin,
+		Command:  command.Command,
+		State:    string(JobStateQueued),
+		QueuedAt: time.Now(),
+	}
+	if !command.ExpiresAt.IsZero() {
+		expiresAt := command.ExpiresAt
+		job.ExpiresAt = &expiresAt
+	}
+	h.jobs[id] = job
+	h.order = append(h.order, id)
+	h.evict()
+	return id
+}
+
+// evict removes the oldest finished jobs if the history is too long, must be called with h.mu held
+func (h *jobHistory) evict() {
+	for i := 0; len(h.order) > maxJobHistory && i < len(h.order); {
+		id := h.order[i]
+		if job, ok := h.jobs[id]; ok && !JobState(job.State).finished() {
+			i++
+			continue
+		}
+		delete(h.jobs, id)
+		h.order = append(h.order[:i], h.order[i+1:]...)
+	}
+}
+
+// setState sets the state of the jobs of the command (including coalesced commands)
+func (h *jobHistory) setState(command *commands.Command, state JobState) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for _, id := range command.JobIds() {
+		job, ok := h.jobs[id]
+		if !ok || JobState(job.State).finished() {
+			continue
+		}
+		if state == JobStateExecuting {
+			job.Attempts++
+			if job.StartedAt == nil {
+				job.StartedAt = &now
+			}
+		}
+		job.State = string(state)
+	}
+}
+
+// finish sets the jobs of the command to succeeded, failed, canceled or expired and publishes them to the event stream
+func (h *jobHistory) finish(command *commands.Command, err error) {
+	if h == nil {
+		return
+	}
+	var finished []models.JobStatus
+	defer func() {
+		for _, job := range finished {
+			events.Publish(events.TypeCommand, job.Vin, job)
+		}
+	}()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for _, id := range command.JobIds() {
+		job, ok := h.jobs[id]
+		if !ok || JobState(job.State).finished() {
+			continue
+		}
+		if errors.Is(err, ErrCommandCanceled) {
+			job.State = string(JobStateCanceled)
+			job.Error = err.Error()
+		} else if errors.Is(err, ErrCommandExpired) {
+			job.State = string(JobStateExpired)
+			job.Error = err.Error()
+		} else if err != nil {
+			job.State = string(JobStateFailed)
+			job.Error = err.Error()
+		} else {
+			job.State = string(JobStateSucceeded)
+		}
+		job.FinishedAt = &now
+		job.DurationMs = now.Sub(job.QueuedAt).Milliseconds()
+		finished = append(finished, *job)
+	}
+}
+
+// get returns a copy of the job
+func (h *jobHistory) get(id string) (models.JobStatus, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job, ok := h.jobs[id]
+	if !ok {
+		return models.JobStatus{}, false
+	}
+	return *job, true
+}
+
+// GetJob returns the state of a queued or finished command
+func (bc *BleControl) GetJob(id string) (models.JobStatus, bool) {
+	return bc.jobs.get(id)
+}
@@ -0,0 +1,60 @@
+package control
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+func TestJobHistoryStates(t *testing.T) {
+	history := newJobHistory()
+	command := &commands.Command{Command: "charge_start", Vin: "VIN"}
+	command.JobId = history.add(command)
+
+	history.setState(command, JobStateExecuting)
+	history.setState(command, JobStateRetrying)
+	history.setState(command, JobStateExecuting)
+	history.finish(command, errors.New("vehicle rejected command"))
+
+	job, ok := history.get(command.JobId)
+	if !ok {
+		t.Fatal("job not found")
+	}
+	if job.State != string(JobStateFailed) || job.Error != "vehicle rejected command" {
+		t.Errorf("unexpected job state %s (%s)", job.State, job.Error)
+	}
+	if job.Attempts != 2 || job.StartedAt == nil || job.FinishedAt == nil {
+		t.Errorf("unexpected job timing %+v", job)
+	}
+
+	// A finished job does not change anymore
+	history.setState(command, JobStateExecuting)
+	if job, _ := history.get(command.JobId); job.State != string(JobStateFailed) {
+		t.Errorf("finished job changed to %s", job.State)
+	}
+}
+
+func TestJobHistoryKeepsUnfinishedJobs(t *testing.T) {
+	history := newJobHistory()
+	queued := &commands.Command{Command: "charge_start", Vin: "VIN"}
+	queued.JobId = history.add(queued)
+
+	var last string
+	for i := 0; i < maxJobHistory+10; i++ {
+		command := &commands.Command{Command: "flash_lights", Vin: "VIN"}
+		command.JobId = history.add(command)
+		history.finish(command, nil)
+		last = command.JobId
+	}
+
+	if len(history.jobs) != maxJobHistory {
+		t.Errorf("expected %d jobs, got %d", maxJobHistory, len(history.jobs))
+	}
+	if _, ok := history.get(queued.JobId); !ok {
+		t.Errorf("queued job was removed")
+	}
+	if _, ok := history.get(last); !ok {
+		t.Errorf("newest job was removed")
+	}
+}
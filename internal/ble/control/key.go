@@ -122,8 +122,7 @@ func RemoveKeyFiles() (error, error) {
 
 func SendKeysToVehicle(vin string, role string) error {
 	tempBleControl := &BleControl{
-		privateKey:   nil,
-		commandStack: make(chan commands.Command, 1),
+		privateKey: nil,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -0,0 +1,36 @@
+package control
+
+import (
+	"slices"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+// chargingManagerCommands are the commands a Charging Manager key can authorize
+var chargingManagerCommands = []string{"vehicle_data", "session_info", "wake_up", "charge_start", "charge_stop", "set_charging_amps"}
+
+// GetAllowedCommands returns the commands that can be authorized with a key of the given role
+func GetAllowedCommands(role string) []string {
+	switch role {
+	case KeyRoleOwner:
+		return commands.ExceptedCommands
+	case KeyRoleChargingManager:
+		return chargingManagerCommands
+	default:
+		return []string{}
+	}
+}
+
+// IsCommandAllowed returns true if a key of the given role can authorize the command
+func IsCommandAllowed(role string, command string) bool {
+	return slices.Contains(GetAllowedCommands(role), command)
+}
+
+// GetCapabilities returns the allowed commands for every key role
+func GetCapabilities() map[string][]string {
+	capabilities := make(map[string][]string, len(validRoles))
+	for _, role := range validRoles {
+		capabilities[role] = GetAllowedCommands(role)
+	}
+	return capabilities
+}
@@ -0,0 +1,118 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+var (
+	// ErrCommandCanceled is the error of commands that were removed from the queue
+	ErrCommandCanceled = errors.New("command canceled")
+	// ErrCommandExpired is the error of commands that were not executed before they expired
+	ErrCommandExpired = errors.New("command expired")
+	// ErrJobNotQueued is returned if the job is not waiting in the queue of the vehicle
+	ErrJobNotQueued = errors.New("job is not queued")
+	// ErrJobInFlight is returned if the job is already executed and cannot be canceled anymore
+	ErrJobInFlight = errors.New("job is already executed")
+)
+
+// queuedCommand returns the queue view of a command
+func (bc *BleControl) queuedCommand(command *commands.Command) models.QueuedCommand {
+	queued := models.QueuedCommand{
+		JobId:           command.JobId,
+		CoalescedJobIds: command.CoalescedJobIds(),
+		Command:         command.Command,
+		Priority:        command.Priority.String(),
+		Body:            commands.RedactBody(command.Body), // Readable with the read scope, so secrets are masked
+		State:           string(JobStateQueued),
+	}
+	if job, ok := bc.jobs.get(command.JobId); ok {
+		queued.State = job.State
+		queued.Attempts = job.Attempts
+		queued.Retries = max(job.Attempts-1, 0)
+		queued.QueuedAt = job.QueuedAt
+		queued.ExpiresAt = job.ExpiresAt
+	}
+	return queued
+}
+
+// GetQueue returns the command in flight and the pending commands of a vehicle in execution order
+func (bc *BleControl) GetQueue(vin string) models.QueueStatus {
+	status := models.QueueStatus{
+		Vin:     vin,
+		State:   string(SessionStateIdle),
+		Pending: []models.QueuedCommand{},
+	}
+	session, ok := bc.lookupSession(vin)
+	if !ok {
+		return status
+	}
+
+	status.State = session.status().State
+	if command := session.getInFlight(); command != nil {
+		inFlight := bc.queuedCommand(command)
+		status.InFlight = &inFlight
+	}
+	for _, command := range session.queue.snapshot() {
+		status.Pending = append(status.Pending, bc.queuedCommand(command))
+	}
+	return status
+}
+
+// CancelCommand removes a pending command from the queue of a vehicle.
+// A job that was coalesced with other jobs is detached, the other jobs stay queued.
+func (bc *BleControl) CancelCommand(vin string, jobId string) error {
+	session, ok := bc.lookupSession(vin)
+	if !ok {
+		return ErrJobNotQueued
+	}
+	command := session.queue.remove(jobId)
+	if command == nil {
+		if inFlight := session.getInFlight(); inFlight != nil && inFlight.HasJob(jobId) {
+			return ErrJobInFlight
+		}
+		return ErrJobNotQueued
+	}
+	logging.Info("Command canceled", "VIN", vin, "Command", command.Command, "JobId", jobId)
+	bc.cancelCommand(command)
+	return nil
+}
+
+// FlushQueue removes all pending commands of a vehicle and returns the number of canceled commands.
+// The command in flight is not affected.
+func (bc *BleControl) FlushQueue(vin string) int {
+	session, ok := bc.lookupSession(vin)
+	if !ok {
+		return 0
+	}
+	canceled := session.queue.clear()
+	for _, command := range canceled {
+		bc.cancelCommand(command)
+	}
+	if len(canceled) > 0 {
+		logging.Info("Command queue flushed", "VIN", vin, "Canceled", len(canceled))
+	}
+	return len(canceled)
+}
+
+func (bc *BleControl) cancelCommand(command *commands.Command) {
+	bc.jobs.finish(command, ErrCommandCanceled)
+	command.Complete(ErrCommandCanceled)
+}
+
+// expireCommand drops a command that was not executed before its expiry
+func (bc *BleControl) expireCommand(command *commands.Command) {
+	err := expiredError(command)
+	logging.Warn("Command expired, dropped", "VIN", command.Vin, "Command", command.Command, "Body", commands.RedactBody(command.Body), "ExpiresAt", command.ExpiresAt)
+	bc.jobs.finish(command, err)
+	command.Complete(err)
+}
+
+func expiredError(command *commands.Command) error {
+	return fmt.Errorf("%w: not executed before %s", ErrCommandExpired, command.ExpiresAt.Format(time.RFC3339))
+}
@@ -0,0 +1,469 @@
+package control
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+// maxQueueSize is the maximum number of queued commands per vehicle
+const maxQueueSize = 50
+
+// fairCommandBudget is the number of commands a session may execute in a row while other sessions wait for a connection
+const fairCommandBudget = 3
+
+// sessionIdleTimeout is the time after which a session without queued commands is removed
+var sessionIdleTimeout = 10 * time.Minute
+
+type SessionState string
+
+const (
+	SessionStateIdle       SessionState = "idle"       // No connection and no queued commands
+	SessionStateWaiting    SessionState = "waiting"    // Waiting for a free connection slot
+	SessionStateConnecting SessionState = "connecting" // Connecting to the vehicle
+	SessionStateConnected  SessionState = "connected"  // Connection established, executing commands
+)
+
+// commandQueue is a queue of commands for one vehicle, ordered by priority and then by arrival
+type commandQueue struct {
+	mu       sync.Mutex
+	commands []*commands.Command
+	notify   chan struct{}
+}
+
+func newCommandQueue() *commandQueue {
+	return &commandQueue{
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *commandQueue) push(command *commands.Command) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// A newer setter replaces the queued one and low priority reads are merged instead of piling up
+	for i, queued := range q.commands {
+		if command.CanCoalesce(queued) {
+			command.Coalesce(queued)
+			q.commands = slices.Delete(q.commands, i, i+1)
+			logging.Debug("Command coalesced with queued command", "VIN", command.Vin, "Command", command.Command, "Body", commands.RedactBody(command.Body))
+			break
+		}
+	}
+
+	if len(q.commands) >= maxQueueSize {
+		return fmt.Errorf("command queue for %s is full (%d commands)", command.Vin, maxQueueSize)
+	}
+
+	q.insert(command)
+	q.signal()
+	return nil
+}
+
+// insert inserts the command behind all commands with the same or a higher priority, must be called with q.mu held
+func (q *commandQueue) insert(command *commands.Command) {
+	position := len(q.commands)
+	for i, queued := range q.commands {
+		if queued.Priority < command.Priority {
+			position = i
+			break
+		}
+	}
+	q.commands = slices.Insert(q.commands, position, command)
+}
+
+// pop returns the next command or nil if the queue is empty
+func (q *commandQueue) pop() *commands.Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.commands) == 0 {
+		return nil
+	}
+	command := q.commands[0]
+	q.commands[0] = nil
+	q.commands = q.commands[1:]
+	return command
+}
+
+// peekPriority returns the priority of the next command, false if the queue is empty
+func (q *commandQueue) peekPriority() (commands.Priority, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.commands) == 0 {
+		return commands.PriorityLow, false
+	}
+	return q.commands[0].Priority, true
+}
+
+// snapshot returns the queued commands in execution order
+func (q *commandQueue) snapshot() []*commands.Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Clone(q.commands)
+}
+
+// remove removes the job from the queue and returns its command, nil if it is not queued.
+// A coalesced job is detached, the command of the remaining jobs stays queued.
+func (q *commandQueue) remove(jobId string) *commands.Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, queued := range q.commands {
+		if !queued.HasJob(jobId) {
+			continue
+		}
+		q.commands = slices.Delete(q.commands, i, i+1)
+		if detached, remaining := queued.Detach(jobId); detached != nil {
+			// The remaining command may have a lower priority, so it is queued again
+			q.insert(remaining)
+			return detached
+		}
+		return queued
+	}
+	return nil
+}
+
+// removeExpired removes and returns the commands that expired before now
+func (q *commandQueue) removeExpired(now time.Time) []*commands.Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var expired []*commands.Command
+	q.commands = slices.DeleteFunc(q.commands, func(queued *commands.Command) bool {
+		if queued.Expired(now) {
+			expired = append(expired, queued)
+			return true
+		}
+		return false
+	})
+	return expired
+}
+
+// clear removes and returns all queued commands
+func (q *commandQueue) clear() []*commands.Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queued := q.commands
+	q.commands = nil
+	return queued
+}
+
+func (q *commandQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.commands)
+}
+
+// signal wakes up a waiting receiver, must be called with q.mu held
+func (q *commandQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// connectionSlots limits the number of concurrent BLE connections.
+// Free slots are handed out by priority and then in the order they were requested, so every vehicle gets its turn.
+type connectionSlots struct {
+	mu      sync.Mutex
+	free    int
+	waiters []*slotWaiter
+}
+
+type slotWaiter struct {
+	priority commands.Priority
+	ready    chan struct{}
+}
+
+func newConnectionSlots(size int) *connectionSlots {
+	if size < 1 {
+		size = 1
+	}
+	return &connectionSlots{free: size}
+}
+
+// acquire blocks until a slot is free or stop is closed. Returns false if stopped.
+func (s *connectionSlots) acquire(stop <-chan struct{}, priority commands.Priority) bool {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiters) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return true
+	}
+	waiter := &slotWaiter{priority: priority, ready: make(chan struct{})}
+	position := len(s.waiters)
+	for i, queued := range s.waiters {
+		if queued.priority < priority {
+			position = i
+			break
+		}
+	}
+	s.waiters = slices.Insert(s.waiters, position, waiter)
+	s.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return true
+	case <-stop:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if i := slices.Index(s.waiters, waiter); i >= 0 {
+			s.waiters = slices.Delete(s.waiters, i, i+1)
+			return false
+		}
+		// The slot was handed over in the meantime, pass it on
+		s.releaseLocked()
+		return false
+	}
+}
+
+func (s *connectionSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+func (s *connectionSlots) releaseLocked() {
+	if len(s.waiters) > 0 {
+		waiter := s.waiters[0]
+		s.waiters = s.waiters[1:]
+		close(waiter.ready)
+		return
+	}
+	s.free++
+}
+
+// waiting returns the number of sessions waiting for a slot
+func (s *connectionSlots) waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiters)
+}
+
+// highestWaitingPriority returns the highest priority of the waiting sessions, false if no session is waiting
+func (s *connectionSlots) highestWaitingPriority() (commands.Priority, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiters) == 0 {
+		return commands.PriorityLow, false
+	}
+	return s.waiters[0].priority, true
+}
+
+// vehicleSession holds the command queue and the connection state of one vehicle
+type vehicleSession struct {
+	vin   string
+	bc    *BleControl
+	queue *commandQueue
+
+	mu            sync.RWMutex
+	state         SessionState
+	inFlight      *commands.Command
+	lastConnected time.Time
+	lastError     string
+}
+
+func newVehicleSession(bc *BleControl, vin string) *vehicleSession {
+	return &vehicleSession{
+		vin:   vin,
+		bc:    bc,
+		queue: newCommandQueue(),
+		state: SessionStateIdle,
+	}
+}
+
+func (s *vehicleSession) setState(state SessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == SessionStateConnected {
+		s.lastConnected = time.Now()
+	}
+	s.state = state
+}
+
+// setInFlight sets the command that is currently connecting or executing, nil if none
+func (s *vehicleSession) setInFlight(command *commands.Command) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight = command
+}
+
+func (s *vehicleSession) getInFlight() *commands.Command {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.inFlight
+}
+
+func (s *vehicleSession) setLastError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lastError = err.Error()
+	} else {
+		s.lastError = ""
+	}
+}
+
+func (s *vehicleSession) status() models.SessionStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := models.SessionStatus{
+		Vin:        s.vin,
+		State:      string(s.state),
+		QueueDepth: s.queue.len(),
+		LastError:  s.lastError,
+	}
+	if !s.lastConnected.IsZero() {
+		status.LastConnected = s.lastConnected.Unix()
+	}
+	return status
+}
+
+// loop waits for queued commands and operates a connection to the vehicle while commands are available
+func (s *vehicleSession) loop() {
+	var retryCommand *commands.Command
+	for {
+		command := retryCommand
+		var priority commands.Priority
+		if command == nil {
+			var ok bool
+			if priority, ok = s.waitForCommand(); !ok {
+				return
+			}
+		} else {
+			priority = command.Priority
+			logging.Info("Retrying command", "VIN", s.vin, "Command", command.Command, "Body", commands.RedactBody(command.Body))
+		}
+
+		s.setState(SessionStateWaiting)
+		if !s.bc.slots.acquire(s.bc.stop, priority) {
+			return
+		}
+		// Take the command only now, a more important one may have been queued in the meantime.
+		// A command is never executed late, so the retried command is checked after waiting for the slot.
+		if command == nil {
+			command = s.nextCommand()
+		} else if command.Expired(time.Now()) {
+			s.bc.expireCommand(command)
+			command = nil
+		}
+		retryCommand = nil
+		if command != nil {
+			s.setInFlight(command)
+			retryCommand = s.bc.connectToVehicleAndOperateConnection(s, command)
+		}
+		s.setInFlight(retryCommand)
+		s.bc.slots.release()
+		s.setState(SessionStateIdle)
+
+		// Give the adapter some time before the next connection
+		select {
+		case <-time.After(1 * time.Second):
+		case <-s.bc.stop:
+			return
+		}
+	}
+}
+
+// nextCommand pops the next command, expired commands are dropped instead of being executed late
+func (s *vehicleSession) nextCommand() *commands.Command {
+	for _, command := range s.queue.removeExpired(time.Now()) {
+		s.bc.expireCommand(command)
+	}
+	return s.queue.pop()
+}
+
+// waitForCommand blocks until a command is queued and returns its priority.
+// Returns false if the BleControl is stopped or the session was removed after being idle for sessionIdleTimeout.
+func (s *vehicleSession) waitForCommand() (commands.Priority, bool) {
+	idle := time.NewTimer(sessionIdleTimeout)
+	defer idle.Stop()
+	for {
+		if priority, ok := s.queue.peekPriority(); ok {
+			return priority, true
+		}
+		logging.Debug("Waiting for next command ...", "VIN", s.vin)
+		select {
+		case <-s.queue.notify:
+		case <-idle.C:
+			if s.bc.removeIdleSession(s) {
+				return commands.PriorityLow, false
+			}
+			idle.Reset(sessionIdleTimeout)
+		case <-s.bc.stop:
+			return commands.PriorityLow, false
+		}
+	}
+}
+
+// yieldConnection returns true if the session should close its connection so that another vehicle gets its turn.
+// A vehicle waiting with more important commands preempts the connection, otherwise the vehicles take turns.
+func (s *vehicleSession) yieldConnection(executedCommands int) bool {
+	waitingPriority, waiting := s.bc.slots.highestWaitingPriority()
+	if !waiting {
+		return false
+	}
+	nextPriority, queued := s.queue.peekPriority()
+	if !queued || waitingPriority > nextPriority {
+		return true
+	}
+	return waitingPriority == nextPriority && executedCommands >= fairCommandBudget
+}
+
+// getSession returns the session of a vehicle and creates it if necessary.
+// The caller must hold sessionsMu until the command is queued, otherwise the session may be removed as idle in between.
+func (bc *BleControl) getSession(vin string) *vehicleSession {
+	session, ok := bc.sessions[vin]
+	if !ok {
+		session = newVehicleSession(bc, vin)
+		bc.sessions[vin] = session
+		go session.loop()
+		logging.Debug("Session created", "VIN", vin)
+	}
+	return session
+}
+
+// removeIdleSession removes the session if its queue is still empty and returns true if it was removed
+func (bc *BleControl) removeIdleSession(session *vehicleSession) bool {
+	bc.sessionsMu.Lock()
+	defer bc.sessionsMu.Unlock()
+	if session.queue.len() > 0 {
+		return false
+	}
+	if bc.sessions[session.vin] == session {
+		delete(bc.sessions, session.vin)
+	}
+	logging.Debug("Idle session removed", "VIN", session.vin)
+	return true
+}
+
+// lookupSession returns the session of a vehicle without creating it
+func (bc *BleControl) lookupSession(vin string) (*vehicleSession, bool) {
+	bc.sessionsMu.Lock()
+	defer bc.sessionsMu.Unlock()
+	session, ok := bc.sessions[vin]
+	return session, ok
+}
+
+// GetSessionStatus returns the state and queue depth of all vehicle sessions
+func (bc *BleControl) GetSessionStatus() []models.SessionStatus {
+	bc.sessionsMu.Lock()
+	sessions := make([]*vehicleSession, 0, len(bc.sessions))
+	for _, session := range bc.sessions {
+		sessions = append(sessions, session)
+	}
+	bc.sessionsMu.Unlock()
+
+	status := make([]models.SessionStatus, 0, len(sessions))
+	for _, session := range sessions {
+		status = append(status, session.status())
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Vin < status[j].Vin
+	})
+	return status
+}
@@ -0,0 +1,328 @@
+package control
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+func TestCommandQueue(t *testing.T) {
+	queue := newCommandQueue()
+
+	for i := 0; i < maxQueueSize; i++ {
+		if err := queue.push(&commands.Command{Command: "charge_start", Vin: "VIN"}); err != nil {
+			t.Fatalf("push %d failed: %s", i, err)
+		}
+	}
+	if err := queue.push(&commands.Command{Command: "charge_stop", Vin: "VIN"}); err == nil {
+		t.Errorf("push to a full queue should fail")
+	}
+	if queue.len() != maxQueueSize {
+		t.Errorf("expected %d queued commands, got %d", maxQueueSize, queue.len())
+	}
+
+	for i := 0; i < maxQueueSize; i++ {
+		if queue.pop() == nil {
+			t.Fatalf("pop %d returned nil", i)
+		}
+	}
+	if queue.pop() != nil {
+		t.Errorf("pop on an empty queue should return nil")
+	}
+}
+
+func TestConnectionSlotsAreHandedOutInOrder(t *testing.T) {
+	slots := newConnectionSlots(1)
+	stop := make(chan struct{})
+
+	if !slots.acquire(stop, commands.PriorityNormal) {
+		t.Fatal("first acquire failed")
+	}
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			if slots.acquire(stop, commands.PriorityNormal) {
+				order <- i
+				slots.release()
+			}
+		}(i)
+		// Make sure the waiters are queued in order
+		for slots.waiting() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	slots.release()
+	for i := 0; i < 3; i++ {
+		select {
+		case got := <-order:
+			if got != i {
+				t.Errorf("expected waiter %d to get the slot, got %d", i, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for slot")
+		}
+	}
+}
+
+func TestConnectionSlotsStop(t *testing.T) {
+	slots := newConnectionSlots(1)
+	stop := make(chan struct{})
+
+	if !slots.acquire(stop, commands.PriorityNormal) {
+		t.Fatal("first acquire failed")
+	}
+
+	result := make(chan bool)
+	go func() {
+		result <- slots.acquire(stop, commands.PriorityNormal)
+	}()
+	for slots.waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stop)
+	if <-result {
+		t.Errorf("acquire should fail after stop")
+	}
+	if slots.waiting() != 0 {
+		t.Errorf("stopped waiter should be removed")
+	}
+}
+
+func TestCommandQueuePriority(t *testing.T) {
+	queue := newCommandQueue()
+	queue.push(&commands.Command{Command: "flash_lights", Vin: "VIN", Priority: commands.PriorityNormal})
+	queue.push(&commands.Command{Command: "honk_horn", Vin: "VIN", Priority: commands.PriorityNormal})
+	queue.push(&commands.Command{Command: "charge_stop", Vin: "VIN", Priority: commands.PriorityHigh})
+
+	expected := []string{"charge_stop", "flash_lights", "honk_horn"}
+	for _, name := range expected {
+		if command := queue.pop(); command == nil || command.Command != name {
+			t.Errorf("expected %s, got %v", name, command)
+		}
+	}
+}
+
+func TestCommandQueueCoalescesLowPriorityReads(t *testing.T) {
+	queue := newCommandQueue()
+	first := &models.ApiResponse{}
+	second := &models.ApiResponse{}
+	queue.push(&commands.Command{Command: "vehicle_data", Vin: "VIN", Body: map[string]interface{}{"endpoints": []string{"charge_state"}}, Response: first, Priority: commands.PriorityLow})
+	queue.push(&commands.Command{Command: "vehicle_data", Vin: "VIN", Body: map[string]interface{}{"endpoints": []string{"climate_state", "charge_state"}}, Response: second, Priority: commands.PriorityLow})
+
+	if queue.len() != 1 {
+		t.Fatalf("expected 1 queued command, got %d", queue.len())
+	}
+	command := queue.pop()
+	if endpoints := command.Body["endpoints"].([]string); len(endpoints) != 2 {
+		t.Errorf("expected merged endpoints, got %v", endpoints)
+	}
+	if command.Response != second || len(command.Coalesced) != 2 || command.Coalesced[0].Response != first {
+		t.Errorf("expected the newest response to be executed and the older one to be coalesced")
+	}
+
+	command.Response.Response = []byte(`{"charge_state":{}}`)
+	command.Complete(nil)
+	if !first.Result || string(first.Response) != `{"charge_state":{}}` {
+		t.Errorf("coalesced response did not get the result")
+	}
+}
+
+func TestConnectionSlotsPriority(t *testing.T) {
+	slots := newConnectionSlots(1)
+	stop := make(chan struct{})
+	slots.acquire(stop, commands.PriorityNormal)
+
+	order := make(chan commands.Priority, 2)
+	for i, priority := range []commands.Priority{commands.PriorityLow, commands.PriorityHigh} {
+		go func(priority commands.Priority) {
+			if slots.acquire(stop, priority) {
+				order <- priority
+				slots.release()
+			}
+		}(priority)
+		for slots.waiting() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	slots.release()
+	if got := <-order; got != commands.PriorityHigh {
+		t.Errorf("expected high priority waiter first, got %s", got)
+	}
+	if got := <-order; got != commands.PriorityLow {
+		t.Errorf("expected low priority waiter second, got %s", got)
+	}
+}
+
+func TestCommandQueueSetterLastWriterWins(t *testing.T) {
+	queue := newCommandQueue()
+	first := &models.ApiResponse{}
+	queue.push(&commands.Command{Command: "set_charging_amps", Vin: "VIN", Body: map[string]interface{}{"charging_amps": 6}, Response: first, Priority: commands.PriorityHigh})
+	queue.push(&commands.Command{Command: "charge_start", Vin: "VIN", Priority: commands.PriorityHigh})
+	queue.push(&commands.Command{Command: "set_charging_amps", Vin: "VIN", Body: map[string]interface{}{"charging_amps": 10}, Priority: commands.PriorityHigh})
+
+	if queue.len() != 2 {
+		t.Fatalf("expected 2 queued commands, got %d", queue.len())
+	}
+	queue.pop()
+	command := queue.pop()
+	if command.Body["charging_amps"] != 10 {
+		t.Errorf("expected the newest body, got %v", command.Body)
+	}
+	command.Complete(nil)
+	if !first.Result {
+		t.Errorf("expected the waiting caller to get the result of the newest command")
+	}
+}
+
+func TestCancelQueuedCommand(t *testing.T) {
+	bc := &BleControl{jobs: newJobHistory()}
+	session := newVehicleSession(bc, "VIN")
+	bc.sessions = map[string]*vehicleSession{"VIN": session}
+
+	first := &commands.Command{Command: "flash_lights", Vin: "VIN", Response: &models.ApiResponse{}}
+	second := &commands.Command{Command: "honk_horn", Vin: "VIN"}
+	third := &commands.Command{Command: "speed_limit_deactivate", Vin: "VIN", Body: map[string]interface{}{"pin": "1234"}}
+	for _, command := range []*commands.Command{first, second, third} {
+		command.JobId = bc.jobs.add(command)
+		session.queue.push(command)
+	}
+	session.setInFlight(session.queue.pop())
+
+	if err := bc.CancelCommand("VIN", first.JobId); err != ErrJobInFlight {
+		t.Errorf("expected the command in flight not to be canceled, got %v", err)
+	}
+	if err := bc.CancelCommand("VIN", second.JobId); err != nil {
+		t.Fatalf("cancel failed: %s", err)
+	}
+	if err := bc.CancelCommand("VIN", second.JobId); err != ErrJobNotQueued {
+		t.Errorf("expected a canceled command not to be queued anymore, got %v", err)
+	}
+	if job, _ := bc.GetJob(second.JobId); job.State != string(JobStateCanceled) {
+		t.Errorf("expected state canceled, got %s", job.State)
+	}
+
+	queue := bc.GetQueue("VIN")
+	if queue.InFlight == nil || queue.InFlight.JobId != first.JobId {
+		t.Errorf("expected %s in flight, got %v", first.JobId, queue.InFlight)
+	}
+	if len(queue.Pending) != 1 || queue.Pending[0].JobId != third.JobId {
+		t.Errorf("expected only %s to be pending, got %v", third.JobId, queue.Pending)
+	} else if queue.Pending[0].Body["pin"] != "***" {
+		t.Errorf("expected the PIN to be masked, got %v", queue.Pending[0].Body)
+	}
+
+	if canceled := bc.FlushQueue("VIN"); canceled != 1 {
+		t.Errorf("expected 1 canceled command, got %d", canceled)
+	}
+	if session.queue.len() != 0 {
+		t.Errorf("expected an empty queue after flush")
+	}
+}
+
+func TestCancelCoalescedJob(t *testing.T) {
+	bc := &BleControl{jobs: newJobHistory()}
+	session := newVehicleSession(bc, "VIN")
+	bc.sessions = map[string]*vehicleSession{"VIN": session}
+
+	older := &commands.Command{Command: "set_charging_amps", Vin: "VIN", Body: map[string]interface{}{"charging_amps": 8}, Response: &models.ApiResponse{}}
+	newer := &commands.Command{Command: "set_charging_amps", Vin: "VIN", Body: map[string]interface{}{"charging_amps": 16}, Response: &models.ApiResponse{}}
+	for _, command := range []*commands.Command{older, newer} {
+		command.JobId = bc.jobs.add(command)
+		session.queue.push(command)
+	}
+
+	// Canceling the superseded job must not cancel the newer caller
+	if err := bc.CancelCommand("VIN", older.JobId); err != nil {
+		t.Fatalf("cancel failed: %s", err)
+	}
+	if job, _ := bc.GetJob(older.JobId); job.State != string(JobStateCanceled) {
+		t.Errorf("expected the older job to be canceled, got %s", job.State)
+	}
+	if job, _ := bc.GetJob(newer.JobId); job.State != string(JobStateQueued) {
+		t.Errorf("expected the newer job to stay queued, got %s", job.State)
+	}
+	queue := bc.GetQueue("VIN")
+	if len(queue.Pending) != 1 || queue.Pending[0].JobId != newer.JobId || len(queue.Pending[0].CoalescedJobIds) != 0 {
+		t.Fatalf("expected only %s to be pending, got %v", newer.JobId, queue.Pending)
+	}
+
+	command := session.queue.pop()
+	if command.Body["charging_amps"] != 16 {
+		t.Errorf("expected the newest body, got %v", command.Body)
+	}
+	command.Complete(nil)
+	if !newer.Response.Result || older.Response.Result {
+		t.Errorf("expected only the newer caller to get the result")
+	}
+}
+
+func TestExpiredCommandsAreDropped(t *testing.T) {
+	bc := &BleControl{jobs: newJobHistory()}
+	session := newVehicleSession(bc, "VIN")
+
+	response := &models.ApiResponse{}
+	expired := &commands.Command{Command: "honk_horn", Vin: "VIN", Response: response, ExpiresAt: time.Now().Add(-time.Second)}
+	valid := &commands.Command{Command: "flash_lights", Vin: "VIN", ExpiresAt: time.Now().Add(time.Minute)}
+	for _, command := range []*commands.Command{expired, valid} {
+		command.JobId = bc.jobs.add(command)
+		session.queue.push(command)
+	}
+
+	if command := session.nextCommand(); command != valid {
+		t.Errorf("expected the expired command to be skipped, got %v", command)
+	}
+	job, _ := bc.GetJob(expired.JobId)
+	if job.State != string(JobStateExpired) || job.Error == "" {
+		t.Errorf("expected state expired with a reason, got %s (%s)", job.State, job.Error)
+	}
+	if response.Result || response.Error == "" {
+		t.Errorf("expected the waiting caller to get the expiry error")
+	}
+}
+
+func TestPushCommandRejectsInvalidVin(t *testing.T) {
+	bc := &BleControl{jobs: newJobHistory(), sessions: map[string]*vehicleSession{}}
+
+	for _, vin := range []string{"", "VIN", "5yj3e1ea7kf000000", "5YJ3E1EA7KF00000/", "5YJ3E1EA7KF0000000"} {
+		if _, err := bc.PushCommand("flash_lights", vin, nil, nil, false, commands.PriorityNormal, time.Time{}); !errors.Is(err, ErrInvalidVin) {
+			t.Errorf("expected %q to be rejected, got %v", vin, err)
+		}
+	}
+	if len(bc.sessions) != 0 {
+		t.Errorf("expected no sessions for invalid VINs, got %d", len(bc.sessions))
+	}
+}
+
+func TestIdleSessionsAreRemoved(t *testing.T) {
+	defer func(timeout time.Duration) { sessionIdleTimeout = timeout }(sessionIdleTimeout)
+	sessionIdleTimeout = 10 * time.Millisecond
+
+	bc := &BleControl{jobs: newJobHistory(), sessions: map[string]*vehicleSession{}, stop: make(chan struct{})}
+	defer close(bc.stop)
+
+	queued := newVehicleSession(bc, "VIN")
+	queued.queue.push(&commands.Command{Command: "flash_lights", Vin: "VIN"})
+	bc.sessions["VIN"] = queued
+	if bc.removeIdleSession(queued) {
+		t.Errorf("expected a session with queued commands not to be removed")
+	}
+
+	bc.sessionsMu.Lock()
+	bc.getSession("5YJ3E1EA7KF000000")
+	bc.sessionsMu.Unlock()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if _, ok := bc.lookupSession("5YJ3E1EA7KF000000"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the idle session to be removed")
+		}
+	}
+}
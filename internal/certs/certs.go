@@ -0,0 +1,150 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+// Files of the self-signed certificate that is generated if no certificate is configured
+var (
+	SelfSignedCertFile = "key/tls/cert.pem"
+	SelfSignedKeyFile  = "key/tls/key.pem"
+)
+
+// selfSignedValidity is the validity of a generated certificate. An expired certificate is replaced on startup.
+const selfSignedValidity = 5 * 365 * 24 * time.Hour
+
+// ServerConfig returns the TLS config of the HTTPS listener. Without a certificate file, a self-signed
+// certificate is generated on the first start. With a client CA file, clients must present a certificate
+// signed by that CA (mutual TLS).
+func ServerConfig(certFile string, keyFile string, clientCaFile string) (*tls.Config, error) {
+	switch {
+	case certFile == "" && keyFile == "":
+		certFile, keyFile = SelfSignedCertFile, SelfSignedKeyFile
+		if err := ensureSelfSigned(certFile, keyFile, time.Now()); err != nil {
+			return nil, err
+		}
+	case certFile == "" || keyFile == "":
+		return nil, fmt.Errorf("tlsCertFile and tlsKeyFile must be set together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	fingerprint := sha256.Sum256(cert.Certificate[0])
+	logging.Info("TLS certificate loaded", "File", certFile, "SHA256", hex.EncodeToString(fingerprint[:]))
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCaFile != "" {
+		caPem, err := os.ReadFile(clientCaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no certificate found in client CA file %s", clientCaFile)
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		logging.Info("TLS client certificates required", "ClientCaFile", clientCaFile)
+	}
+
+	return config, nil
+}
+
+// ensureSelfSigned generates a self-signed certificate unless a valid one exists
+func ensureSelfSigned(certFile string, keyFile string, now time.Time) error {
+	if certPem, err := os.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(certPem); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil && now.Before(cert.NotAfter) {
+				return nil
+			}
+		}
+		logging.Warn("Self-signed certificate is invalid or expired, generating a new one", "File", certFile)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	certPem, keyPem, err := generateSelfSigned(now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPem, 0600); err != nil {
+		return fmt.Errorf("failed to write certificate key: %w", err)
+	}
+	if err := os.WriteFile(certFile, certPem, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	logging.Info("Self-signed certificate generated", "File", certFile)
+	return nil
+}
+
+// generateSelfSigned creates a certificate for the host name, localhost and all addresses of the host
+func generateSelfSigned(now time.Time) (certPem []byte, keyPem []byte, err error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "TeslaBleHttpProxy"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal certificate key: %w", err)
+	}
+	certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem, nil
+}
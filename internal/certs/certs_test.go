@@ -0,0 +1,96 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func useSelfSignedFiles(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	previousCert, previousKey := SelfSignedCertFile, SelfSignedKeyFile
+	SelfSignedCertFile = filepath.Join(dir, "tls", "cert.pem")
+	SelfSignedKeyFile = filepath.Join(dir, "tls", "key.pem")
+	t.Cleanup(func() {
+		SelfSignedCertFile, SelfSignedKeyFile = previousCert, previousKey
+	})
+}
+
+func readCertificate(t *testing.T, file string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read certificate: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("no PEM block in certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse certificate: %s", err)
+	}
+	return cert
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	useSelfSignedFiles(t)
+
+	config, err := ServerConfig("", "", "")
+	if err != nil {
+		t.Fatalf("server config failed: %s", err)
+	}
+	if len(config.Certificates) != 1 || config.ClientAuth != tls.NoClientCert {
+		t.Errorf("expected one certificate and no client authentication")
+	}
+	cert := readCertificate(t, SelfSignedCertFile)
+	if err := cert.VerifyHostname("localhost"); err != nil {
+		t.Errorf("certificate not valid for localhost: %s", err)
+	}
+	if info, err := os.Stat(SelfSignedKeyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the key to be readable by the owner only, got %v", info.Mode())
+	}
+
+	// The certificate is kept on the next start
+	if err := ensureSelfSigned(SelfSignedCertFile, SelfSignedKeyFile, time.Now()); err != nil {
+		t.Fatalf("ensure failed: %s", err)
+	}
+	if readCertificate(t, SelfSignedCertFile).SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Error("a valid certificate should not be replaced")
+	}
+
+	// An expired certificate is replaced
+	if err := ensureSelfSigned(SelfSignedCertFile, SelfSignedKeyFile, cert.NotAfter.Add(time.Hour)); err != nil {
+		t.Fatalf("ensure failed: %s", err)
+	}
+	if readCertificate(t, SelfSignedCertFile).SerialNumber.Cmp(cert.SerialNumber) == 0 {
+		t.Error("an expired certificate should be replaced")
+	}
+}
+
+func TestClientCertificatesRequired(t *testing.T) {
+	useSelfSignedFiles(t)
+	if err := ensureSelfSigned(SelfSignedCertFile, SelfSignedKeyFile, time.Now()); err != nil {
+		t.Fatalf("ensure failed: %s", err)
+	}
+
+	config, err := ServerConfig(SelfSignedCertFile, SelfSignedKeyFile, SelfSignedCertFile)
+	if err != nil {
+		t.Fatalf("server config failed: %s", err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+		t.Error("expected client certificates to be required")
+	}
+
+	if _, err := ServerConfig(SelfSignedCertFile, SelfSignedKeyFile, SelfSignedKeyFile); err == nil {
+		t.Error("a client CA file without certificate should be rejected")
+	}
+	if _, err := ServerConfig(SelfSignedCertFile, "", ""); err == nil {
+		t.Error("a certificate without key should be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+)
+
+// Diff returns the changed fields between two JSON documents. Nested objects are compared field by field
+// (the path is joined with dots), arrays and other values as a whole. An empty old document reports every field.
+func Diff(oldJson json.RawMessage, newJson json.RawMessage) ([]models.FieldChange, error) {
+	var oldValue, newValue interface{}
+	if len(oldJson) > 0 {
+		if err := json.Unmarshal(oldJson, &oldValue); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(newJson, &newValue); err != nil {
+		return nil, err
+	}
+
+	changes := []models.FieldChange{}
+	diffValue("", oldValue, newValue, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+func diffValue(path string, oldValue interface{}, newValue interface{}, changes *[]models.FieldChange) {
+	oldObject, oldIsObject := oldValue.(map[string]interface{})
+	newObject, newIsObject := newValue.(map[string]interface{})
+	if !oldIsObject && !newIsObject {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, models.FieldChange{Path: path, Old: oldValue, New: newValue})
+		}
+		return
+	}
+	// A value that became an object (or the other way round) is compared field by field against nothing
+	if !oldIsObject && oldValue != nil {
+		*changes = append(*changes, models.FieldChange{Path: path, Old: oldValue})
+	}
+	if !newIsObject && newValue != nil {
+		*changes = append(*changes, models.FieldChange{Path: path, New: newValue})
+	}
+
+	for key, value := range newObject {
+		diffValue(joinPath(path, key), oldObject[key], value, changes)
+	}
+	for key, value := range oldObject {
+		if _, ok := newObject[key]; !ok {
+			diffValue(joinPath(path, key), value, nil, changes)
+		}
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	oldJson := []byte(`{"battery_level":80,"charging_state":"Charging","charge_amps":{"actual":16,"request":16},"removed":true}`)
+	newJson := []byte(`{"battery_level":81,"charging_state":"Charging","charge_amps":{"actual":10,"request":16},"added":"x"}`)
+
+	changes, err := Diff(oldJson, newJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"added", "battery_level", "charge_amps.actual", "removed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), changes)
+	}
+	for i, path := range expected {
+		if changes[i].Path != path {
+			t.Errorf("expected change of %s, got %s", path, changes[i].Path)
+		}
+	}
+	if changes[1].Old != float64(80) || changes[1].New != float64(81) {
+		t.Errorf("unexpected values %v -> %v", changes[1].Old, changes[1].New)
+	}
+	if changes[3].New != nil {
+		t.Errorf("removed field should have no new value, got %v", changes[3].New)
+	}
+
+	if changes, _ := Diff(newJson, newJson); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+	if changes, _ := Diff(nil, newJson); len(changes) != 5 {
+		t.Errorf("expected every field without an old document, got %v", changes)
+	}
+}
+
+func TestPublishFiltersByVin(t *testing.T) {
+	subscription := Subscribe("VIN1")
+	defer Unsubscribe(subscription)
+
+	Publish(TypeCommand, "VIN2", nil)
+	Publish(TypeCommand, "VIN1", "done")
+
+	select {
+	case event := <-subscription.C:
+		if event.Vin != "VIN1" || event.Data != "done" {
+			t.Errorf("unexpected event %v", event)
+		}
+	default:
+		t.Fatal("expected an event")
+	}
+	select {
+	case event := <-subscription.C:
+		t.Errorf("unexpected event %v", event)
+	default:
+	}
+}
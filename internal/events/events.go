@@ -0,0 +1,82 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+type Type string
+
+const (
+	TypeVehicleData Type = "vehicle_data" // A cached vehicle data section changed
+	TypeCommand     Type = "command"      // A queued command completed
+	TypeSleepState  Type = "sleep_state"  // The vehicle fell asleep or woke up
+)
+
+// subscriptionBuffer is the number of events buffered per subscriber. Events for slow subscribers are dropped.
+const subscriptionBuffer = 64
+
+// Event is a change of the state of a vehicle
+type Event struct {
+	Id        uint64      `json:"id"`
+	Type      Type        `json:"type"`
+	Vin       string      `json:"vin"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Subscription receives the events of one vehicle (or of all vehicles if the VIN is empty)
+type Subscription struct {
+	C   <-chan Event
+	ch  chan Event
+	vin string
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[*Subscription]struct{})
+	lastId      uint64
+)
+
+// Subscribe returns a subscription for the events of the vehicle. It must be closed with Unsubscribe.
+func Subscribe(vin string) *Subscription {
+	ch := make(chan Event, subscriptionBuffer)
+	subscription := &Subscription{C: ch, ch: ch, vin: vin}
+	mu.Lock()
+	subscribers[subscription] = struct{}{}
+	mu.Unlock()
+	return subscription
+}
+
+// Unsubscribe stops the delivery of events to the subscription
+func Unsubscribe(subscription *Subscription) {
+	mu.Lock()
+	delete(subscribers, subscription)
+	mu.Unlock()
+}
+
+// Publish sends an event to all subscribers of the vehicle without blocking
+func Publish(eventType Type, vin string, data interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	lastId++
+	event := Event{
+		Id:        lastId,
+		Type:      eventType,
+		Vin:       vin,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+	for subscription := range subscribers {
+		if subscription.vin != "" && subscription.vin != vin {
+			continue
+		}
+		select {
+		case subscription.ch <- event:
+		default:
+			logging.Debug("Subscriber too slow, event dropped", "VIN", vin, "Type", eventType)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "tesla_ble_proxy"
+
+// Stages of a connection attempt, used as label of ConnectFailures
+const (
+	StageScan                  = "scan"                   // The beacon of the vehicle was not found
+	StageConnect               = "connect"                // (A) BLE connection could not be opened
+	StageCreateVehicle         = "create_vehicle"         // (B) Vehicle object could not be created
+	StageConnectVehicle        = "connect_vehicle"        // (C) Vehicle did not accept the connection
+	StageVcsecHandshake        = "vcsec_handshake"        // Handshake (A) with the VCSEC domain failed
+	StageInfotainmentHandshake = "infotainment_handshake" // Handshake (B) with the infotainment domain failed
+	StageWakeup                = "wakeup"                 // The vehicle could not be woken up
+)
+
+// connectionBuckets cover a beacon found immediately up to the longest scan timeouts
+var connectionBuckets = []float64{0.25, 0.5, 1, 2, 3, 5, 7.5, 10, 15, 20, 30}
+
+var (
+	ScanDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ble_scan_duration_seconds",
+		Help:      "Duration of the BLE scans for a vehicle beacon.",
+		Buckets:   connectionBuckets,
+	}, []string{"result"})
+
+	ConnectDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ble_connect_duration_seconds",
+		Help:      "Duration from a found beacon to an established vehicle session.",
+		Buckets:   connectionBuckets,
+	}, []string{"result"})
+
+	ConnectFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ble_connect_failures_total",
+		Help:      "Failed connection attempts by the stage that failed.",
+	}, []string{"stage"})
+
+	CommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "Duration of the command execution on an established connection, including retries.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30},
+	}, []string{"command", "result"})
+
+	CommandRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_retries_total",
+		Help:      "Retries of commands after a failed attempt.",
+	}, []string{"command"})
+
+	VehicleDataCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vehicle_data_cache_requests_total",
+		Help:      "Lookups of vehicle data endpoints in the cache.",
+	}, []string{"endpoint", "result"})
+)
+
+// Result returns the result label of an operation
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
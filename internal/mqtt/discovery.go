@@ -0,0 +1,292 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/wimaha/TeslaBleHttpProxy/config"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+// entity is a Home Assistant entity of a vehicle
+type entity struct {
+	component string // sensor, binary_sensor, switch, number or lock
+	key       string
+	name      string
+	section   string // Cached section the state is read from, sleep_state for the sleep state topic
+	template  string // Value template of the state
+	options   map[string]interface{}
+	// Commands the entity sends, it is only published if the active key role can authorize all of them
+	// and their scopes are allowed via MQTT
+	commands []string
+}
+
+// defaultMaxChargingAmps is the maximum of the charging current until the vehicle reported charge_current_request_max
+const defaultMaxChargingAmps = 48
+
+// toggle maps the payloads of a switch or lock to commands
+type toggle struct {
+	on   string
+	off  string
+	body func(on bool) map[string]interface{}
+}
+
+// toggles are the entities that are switched with {prefix}/{vin}/set/{key}
+var toggles = map[string]toggle{
+	"charging": {on: "charge_start", off: "charge_stop"},
+	"climate":  {on: "auto_conditioning_start", off: "auto_conditioning_stop"},
+	"sentry": {on: "set_sentry_mode", off: "set_sentry_mode", body: func(on bool) map[string]interface{} {
+		return map[string]interface{}{"on": on}
+	}},
+	"lock": {on: "door_lock", off: "door_unlock"},
+}
+
+func sensor(key string, name string, section string, unit string, deviceClass string) entity {
+	options := map[string]interface{}{"state_class": "measurement"}
+	if unit != "" {
+		options["unit_of_measurement"] = unit
+	}
+	if deviceClass != "" {
+		options["device_class"] = deviceClass
+	}
+	return entity{component: "sensor", key: key, name: name, section: section, template: "{{ value_json." + key + " }}", options: options}
+}
+
+var entities = []entity{
+	sensor("battery_level", "Battery level", "charge_state", "%", "battery"),
+	sensor("usable_battery_level", "Usable battery level", "charge_state", "%", "battery"),
+	// The unit depends on the display settings of the vehicle, so the range is published without unit
+	sensor("battery_range", "Battery range", "charge_state", "", ""),
+	sensor("charge_limit_soc", "Charge limit", "charge_state", "%", ""),
+	sensor("charger_power", "Charger power", "charge_state", "kW", "power"),
+	sensor("charger_voltage", "Charger voltage", "charge_state", "V", "voltage"),
+	sensor("charger_actual_current", "Charger current", "charge_state", "A", "current"),
+	{component: "sensor", key: "charge_energy_added", name: "Charge energy added", section: "charge_state", template: "{{ value_json.charge_energy_added }}",
+		options: map[string]interface{}{"state_class": "total_increasing", "unit_of_measurement": "kWh", "device_class": "energy"}},
+	sensor("minutes_to_full_charge", "Time to full charge", "charge_state", "min", "duration"),
+	{component: "sensor", key: "charging_state", name: "Charging state", section: "charge_state", template: "{{ value_json.charging_state }}"},
+	{component: "binary_sensor", key: "charge_port_door_open", name: "Charge port door", section: "charge_state",
+		template: "{{ 'ON' if value_json.charge_port_door_open else 'OFF' }}", options: map[string]interface{}{"device_class": "door"}},
+	sensor("inside_temp", "Inside temperature", "climate_state", "°C", "temperature"),
+	sensor("outside_temp", "Outside temperature", "climate_state", "°C", "temperature"),
+	sensor("driver_temp_setting", "Temperature setting", "climate_state", "°C", "temperature"),
+	{component: "binary_sensor", key: "awake", name: "Awake", section: "sleep_state",
+		options: map[string]interface{}{"payload_on": "awake", "payload_off": "asleep"}},
+	{component: "switch", key: "charging", name: "Charging", section: "charge_state",
+		template: "{{ 'ON' if value_json.charging_state in ['Charging', 'Starting'] else 'OFF' }}",
+		commands: []string{"charge_start", "charge_stop"}},
+	{component: "switch", key: "climate", name: "Climate", section: "climate_state",
+		template: "{{ 'ON' if value_json.is_auto_conditioning_on else 'OFF' }}",
+		commands: []string{"auto_conditioning_start", "auto_conditioning_stop"}},
+	{component: "switch", key: "sentry", name: "Sentry mode", section: "closures_state",
+		template: "{{ 'ON' if value_json.sentry_mode else 'OFF' }}",
+		commands: []string{"set_sentry_mode"}},
+	{component: "number", key: "charging_amps", name: "Charging current", section: "charge_state",
+		template: "{{ value_json.charge_current_request }}",
+		options:  map[string]interface{}{"min": 0, "max": defaultMaxChargingAmps, "step": 1, "unit_of_measurement": "A", "device_class": "current", "mode": "box"},
+		commands: []string{"set_charging_amps"}},
+	{component: "lock", key: "lock", name: "Doors", section: "body_controller_state",
+		template: "{{ 'LOCKED' if value_json.vehicle_lock_state in ['VEHICLELOCKSTATE_LOCKED', 'VEHICLELOCKSTATE_INTERNAL_LOCKED'] else 'UNLOCKED' }}",
+		commands: []string{"door_lock", "door_unlock"}},
+}
+
+// allowed returns true if the key role can authorize all commands of the entity and MQTT may send them
+func (e entity) allowed(role string) bool {
+	for _, command := range e.commands {
+		if !control.IsCommandAllowed(role, command) || !scopeAllowed(auth.CommandScope(command)) {
+			return false
+		}
+	}
+	return true
+}
+
+// discoveryTopic returns the config topic of the entity of a vehicle
+func discoveryTopic(vin string, e entity) string {
+	return strings.Join([]string{config.AppConfig.MqttDiscoveryPrefix, e.component, "tesla_ble_" + strings.ToLower(vin), e.key, "config"}, "/")
+}
+
+// discoveryConfig returns the Home Assistant discovery config of the entity of a vehicle
+func (c *Client) discoveryConfig(vin string, e entity) map[string]interface{} {
+	id := "tesla_ble_" + strings.ToLower(vin)
+	discovery := map[string]interface{}{
+		"name":               e.name,
+		"unique_id":          id + "_" + e.key,
+		"object_id":          id + "_" + e.key,
+		"availability_topic": c.StatusTopic(),
+		"device": map[string]interface{}{
+			"identifiers":  []string{id},
+			"name":         "Tesla " + vin,
+			"manufacturer": "Tesla",
+			"sw_version":   config.Version,
+		},
+	}
+	if e.section == "sleep_state" {
+		discovery["state_topic"] = c.Topic(vin, e.section)
+	} else {
+		discovery["state_topic"] = c.StateTopic(vin, e.section)
+	}
+	if e.template != "" {
+		discovery["value_template"] = e.template
+	}
+
+	switch e.component {
+	case "switch":
+		discovery["command_topic"] = c.Topic(vin, "set", e.key)
+	case "lock":
+		discovery["command_topic"] = c.Topic(vin, "set", e.key)
+		discovery["payload_lock"] = "LOCK"
+		discovery["payload_unlock"] = "UNLOCK"
+	case "number":
+		discovery["command_topic"] = c.Topic(vin, "command", e.commands[0])
+		discovery["command_template"] = `{"charging_amps": {{ value | int }}}`
+	}
+	for key, value := range e.options {
+		discovery[key] = value
+	}
+	if e.key == "charging_amps" {
+		c.mu.Lock()
+		if maxAmps, ok := c.maxChargingAmps[vin]; ok {
+			discovery["max"] = maxAmps
+		}
+		c.mu.Unlock()
+	}
+	return discovery
+}
+
+// publishDiscovery publishes the entities of a vehicle that the key role can use and removes the others
+func (c *Client) publishDiscovery(vin string, role string) {
+	for _, e := range entities {
+		topic := discoveryTopic(vin, e)
+		if !e.allowed(role) {
+			c.Publish(topic, true, []byte{})
+			continue
+		}
+		discoveryJson, err := json.Marshal(c.discoveryConfig(vin, e))
+		if err != nil {
+			logging.Error("Failed to marshal discovery config", "Entity", e.key, "Error", err)
+			continue
+		}
+		c.Publish(topic, true, discoveryJson)
+	}
+	logging.Debug("Home Assistant discovery published", "VIN", vin, "Role", role)
+}
+
+// publishAllDiscovery publishes the entities of all known vehicles
+func (c *Client) publishAllDiscovery() {
+	role := control.GetActiveKeyRole()
+	c.mu.Lock()
+	c.discoveryRole = role
+	vins := make([]string, 0, len(c.vins))
+	for vin := range c.vins {
+		vins = append(vins, vin)
+	}
+	c.mu.Unlock()
+
+	for _, vin := range vins {
+		c.publishDiscovery(vin, role)
+	}
+}
+
+// updateDiscovery publishes the entities of a new vehicle, or of all vehicles if the active key role changed
+func (c *Client) updateDiscovery(vin string) {
+	role := control.GetActiveKeyRole()
+	c.mu.Lock()
+	roleChanged := role != c.discoveryRole
+	_, known := c.vins[vin]
+	c.vins[vin] = struct{}{}
+	c.mu.Unlock()
+
+	if roleChanged {
+		c.publishAllDiscovery()
+	} else if !known {
+		c.publishDiscovery(vin, role)
+	}
+}
+
+// updateRole publishes the entities of all vehicles if the active key role changed
+func (c *Client) updateRole() {
+	c.mu.Lock()
+	roleChanged := control.GetActiveKeyRole() != c.discoveryRole
+	c.mu.Unlock()
+
+	if roleChanged {
+		c.publishAllDiscovery()
+	}
+}
+
+// updateMaxChargingAmps publishes the charging current entity again if the maximum current of the vehicle changed
+func (c *Client) updateMaxChargingAmps(vin string, chargeState []byte) {
+	var state struct {
+		ChargeCurrentRequestMax int `json:"charge_current_request_max"`
+	}
+	if err := json.Unmarshal(chargeState, &state); err != nil || state.ChargeCurrentRequestMax <= 0 {
+		return
+	}
+	c.mu.Lock()
+	changed := c.maxChargingAmps[vin] != state.ChargeCurrentRequestMax
+	c.maxChargingAmps[vin] = state.ChargeCurrentRequestMax
+	role := c.discoveryRole
+	c.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	for _, e := range entities {
+		if e.key != "charging_amps" || !e.allowed(role) {
+			continue
+		}
+		discoveryJson, err := json.Marshal(c.discoveryConfig(vin, e))
+		if err != nil {
+			logging.Error("Failed to marshal discovery config", "Entity", e.key, "Error", err)
+			return
+		}
+		c.Publish(discoveryTopic(vin, e), true, discoveryJson)
+	}
+}
+
+// onSet switches a Home Assistant switch or lock entity
+func (c *Client) onSet(_ paho.Client, message paho.Message) {
+	vin, key, ok := parseVehicleTopic(c.prefix, "set", message.Topic())
+	if !ok || message.Retained() {
+		return
+	}
+	t, ok := toggles[key]
+	if !ok {
+		logging.Warn("Unknown MQTT entity", "Topic", message.Topic())
+		return
+	}
+
+	var on bool
+	switch payload := strings.ToUpper(strings.TrimSpace(string(message.Payload()))); payload {
+	case "ON", "LOCK":
+		on = true
+	case "OFF", "UNLOCK":
+		on = false
+	default:
+		logging.Warn("Invalid MQTT payload", "Topic", message.Topic(), "Payload", payload)
+		return
+	}
+
+	command := t.off
+	if on {
+		command = t.on
+	}
+	var body map[string]interface{}
+	if t.body != nil {
+		body = t.body(on)
+	}
+	logging.Debug("Received MQTT entity command", "VIN", vin, "Entity", key, "Command", command)
+	if err := c.pushCommand(vin, command, body); err != nil {
+		c.rejectCommand(vin, command, err)
+	}
+}
+
+func (c *Client) onHomeAssistantStatus(_ paho.Client, message paho.Message) {
+	if string(message.Payload()) == payloadOnline {
+		logging.Debug("Home Assistant is online, publishing discovery")
+		c.publishAllDiscovery()
+	}
+}
@@ -0,0 +1,259 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/wimaha/TeslaBleHttpProxy/config"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/events"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/tesla/commands"
+)
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+)
+
+// Client publishes the vehicle state to an MQTT broker and feeds commands from the broker into the command queue.
+//
+// Topics (with the default prefix tesla-ble):
+//
+//	tesla-ble/status                           online/offline (retained, offline is the last will)
+//	tesla-ble/{vin}/vehicle_data/{section}     cached vehicle data section (retained)
+//	tesla-ble/{vin}/body_controller_state      body controller state (retained)
+//	tesla-ble/{vin}/sleep_state                awake/asleep (retained)
+//	tesla-ble/{vin}/result/{command}           job of a completed command
+//	tesla-ble/{vin}/command/{command}          subscribed, the payload is the JSON body of the command
+//	tesla-ble/{vin}/set/{entity}               subscribed, ON/OFF (LOCK/UNLOCK) of a Home Assistant entity
+type Client struct {
+	client paho.Client
+	prefix string
+
+	// Vehicles with published discovery configs and the key role they were published for
+	mu            sync.Mutex
+	vins          map[string]struct{}
+	discoveryRole string
+	// Maximum charging current of the vehicles, taken from charge_current_request_max
+	maxChargingAmps map[string]int
+}
+
+// instance is the running client, nil if MQTT is disabled
+var instance *Client
+
+// UpdateDiscovery publishes the Home Assistant discovery configs again if the active key role changed
+func UpdateDiscovery() {
+	if instance == nil || !config.AppConfig.MqttDiscovery {
+		return
+	}
+	instance.updateRole()
+}
+
+// Start connects to the configured broker. Returns nil if MQTT is disabled.
+func Start() *Client {
+	if config.AppConfig.MqttBroker == "" {
+		return nil
+	}
+	if err := auth.ValidateScopes(config.AppConfig.MqttScopes); err != nil {
+		logging.Warn("Invalid mqttScopes", "Error", err)
+	}
+
+	c := &Client{
+		prefix:          config.AppConfig.MqttTopicPrefix,
+		vins:            make(map[string]struct{}),
+		maxChargingAmps: make(map[string]int),
+	}
+	for _, vin := range config.AppConfig.PollVins {
+		c.vins[vin] = struct{}{}
+	}
+
+	options := paho.NewClientOptions().
+		AddBroker(config.AppConfig.MqttBroker).
+		SetClientID(config.AppConfig.MqttClientId).
+		SetUsername(config.AppConfig.MqttUsername).
+		SetPassword(config.AppConfig.MqttPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10*time.Second).
+		SetWill(c.StatusTopic(), payloadOffline, 1, true).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logging.Warn("MQTT connection lost", "Error", err)
+		})
+	c.client = paho.NewClient(options)
+
+	logging.Info("Connecting to MQTT broker ...", "Broker", config.AppConfig.MqttBroker)
+	// With ConnectRetry the token only completes once connected, so do not wait for it
+	c.client.Connect()
+
+	go c.publishEvents()
+	instance = c
+	return c
+}
+
+// StatusTopic is the availability topic of the proxy
+func (c *Client) StatusTopic() string {
+	return c.prefix + "/status"
+}
+
+// Topic returns the topic of a vehicle
+func (c *Client) Topic(vin string, path ...string) string {
+	return strings.Join(append([]string{c.prefix, vin}, path...), "/")
+}
+
+// StateTopic returns the topic of a cached section (vehicle data or body controller state)
+func (c *Client) StateTopic(vin string, section string) string {
+	if section == models.BodyControllerStateSection {
+		return c.Topic(vin, section)
+	}
+	return c.Topic(vin, "vehicle_data", section)
+}
+
+// Publish publishes a payload without waiting for the broker. Messages are dropped while disconnected.
+func (c *Client) Publish(topic string, retained bool, payload interface{}) {
+	if !c.client.IsConnectionOpen() {
+		return
+	}
+	token := c.client.Publish(topic, 1, retained, payload)
+	go func() {
+		if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+			logging.Warn("MQTT publish failed", "Topic", topic, "Error", token.Error())
+		}
+	}()
+}
+
+func (c *Client) onConnect(client paho.Client) {
+	logging.Info("Connected to MQTT broker", "Broker", config.AppConfig.MqttBroker)
+	client.Publish(c.StatusTopic(), 1, true, payloadOnline)
+
+	c.subscribe(c.Topic("+", "command", "+"), c.onCommand)
+	if config.AppConfig.MqttDiscovery {
+		c.subscribe(c.Topic("+", "set", "+"), c.onSet)
+		// Home Assistant announces a restart on its status topic, the discovery configs are published again
+		c.subscribe(config.AppConfig.MqttDiscoveryPrefix+"/status", c.onHomeAssistantStatus)
+		c.publishAllDiscovery()
+	}
+}
+
+func (c *Client) subscribe(topic string, handler paho.MessageHandler) {
+	token := c.client.Subscribe(topic, 1, handler)
+	if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+		logging.Error("MQTT subscribe failed", "Topic", topic, "Error", token.Error())
+	}
+}
+
+// publishEvents forwards the state changes of all vehicles to the broker
+func (c *Client) publishEvents() {
+	subscription := events.Subscribe("")
+	defer events.Unsubscribe(subscription)
+
+	for event := range subscription.C {
+		if config.AppConfig.MqttDiscovery {
+			c.updateDiscovery(event.Vin)
+		}
+		switch data := event.Data.(type) {
+		case models.VehicleDataChange:
+			c.Publish(c.StateTopic(event.Vin, data.Section), true, []byte(data.Data))
+			if config.AppConfig.MqttDiscovery && data.Section == "charge_state" {
+				c.updateMaxChargingAmps(event.Vin, data.Data)
+			}
+		case models.SleepStateChange:
+			c.Publish(c.Topic(event.Vin, "sleep_state"), true, data.State)
+		case models.JobStatus:
+			c.publishResult(event.Vin, data)
+		}
+	}
+}
+
+func (c *Client) publishResult(vin string, job models.JobStatus) {
+	jobJson, err := json.Marshal(job)
+	if err != nil {
+		logging.Error("Failed to marshal job", "Error", err)
+		return
+	}
+	c.Publish(c.Topic(vin, "result", job.Command), false, jobJson)
+}
+
+// onCommand pushes a command received from the broker into the command queue of the vehicle
+func (c *Client) onCommand(_ paho.Client, message paho.Message) {
+	vin, command, ok := parseCommandTopic(c.prefix, message.Topic())
+	if !ok {
+		return
+	}
+	// A retained command would be executed again after every reconnect
+	if message.Retained() {
+		logging.Warn("Ignoring retained MQTT command", "Topic", message.Topic())
+		return
+	}
+	logging.Debug("Received MQTT command", "VIN", vin, "Command", command)
+
+	var body map[string]interface{}
+	if payload := strings.TrimSpace(string(message.Payload())); payload != "" {
+		if err := json.Unmarshal([]byte(payload), &body); err != nil {
+			c.rejectCommand(vin, command, fmt.Errorf("invalid JSON body: %s", err))
+			return
+		}
+	}
+	if err := c.pushCommand(vin, command, body); err != nil {
+		c.rejectCommand(vin, command, err)
+	}
+}
+
+// rejectCommand publishes the result of a command that could not be queued
+func (c *Client) rejectCommand(vin string, command string, err error) {
+	logging.Error("MQTT command rejected", "VIN", vin, "Command", command, "Error", err)
+	c.publishResult(vin, models.JobStatus{
+		Vin:      vin,
+		Command:  command,
+		State:    string(control.JobStateFailed),
+		Error:    err.Error(),
+		QueuedAt: time.Now(),
+	})
+}
+
+func (c *Client) pushCommand(vin string, command string, body map[string]interface{}) error {
+	if control.BleControlInstance == nil {
+		return fmt.Errorf("BleControl is not initialized. Maybe private.pem is missing.")
+	}
+	if !slices.Contains(commands.ExceptedCommands, command) {
+		return fmt.Errorf("the command \"%s\" is not supported", command)
+	}
+	if scope := auth.CommandScope(command); !scopeAllowed(scope) {
+		return fmt.Errorf("the command \"%s\" needs the scope \"%s\", which is not allowed via MQTT (see mqttScopes)", command, scope)
+	}
+	if activeRole := control.GetActiveKeyRole(); !control.IsCommandAllowed(activeRole, command) {
+		return fmt.Errorf("the command \"%s\" can not be authorized with the active key role '%s'", command, control.GetKeyRoleDisplayName(activeRole))
+	}
+
+	priority := commands.DefaultPriority(command)
+	// Commands always wake up the car automatically (except wake_up itself)
+	_, err := control.BleControlInstance.PushCommand(command, vin, body, nil, command != "wake_up", priority, commands.DefaultExpiry(priority, time.Now()))
+	return err
+}
+
+// scopeAllowed returns true if commands of the scope are accepted via MQTT. Like for API tokens, the admin scope grants all scopes.
+func scopeAllowed(scope string) bool {
+	return slices.Contains(config.AppConfig.MqttScopes, auth.ScopeAdmin) || slices.Contains(config.AppConfig.MqttScopes, scope)
+}
+
+// parseCommandTopic returns the VIN and the command of a command topic ({prefix}/{vin}/command/{command})
+func parseCommandTopic(prefix string, topic string) (string, string, bool) {
+	return parseVehicleTopic(prefix, "command", topic)
+}
+
+// parseVehicleTopic returns the VIN and the last level of a topic {prefix}/{vin}/{kind}/{name}
+func parseVehicleTopic(prefix string, kind string, topic string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(topic, prefix+"/"), "/")
+	if !strings.HasPrefix(topic, prefix+"/") || len(parts) != 3 || parts[1] != kind || parts[0] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
@@ -0,0 +1,129 @@
+package mqtt
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wimaha/TeslaBleHttpProxy/config"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+)
+
+func TestParseCommandTopic(t *testing.T) {
+	vin, command, ok := parseCommandTopic("tesla-ble", "tesla-ble/LRW3E7FS2NC000001/command/charge_start")
+	if !ok || vin != "LRW3E7FS2NC000001" || command != "charge_start" {
+		t.Errorf("unexpected result %s, %s, %t", vin, command, ok)
+	}
+
+	for _, topic := range []string{
+		"tesla-ble/LRW3E7FS2NC000001/result/charge_start",
+		"tesla-ble/LRW3E7FS2NC000001/command",
+		"tesla-ble/LRW3E7FS2NC000001/command/charge_start/extra",
+		"other/LRW3E7FS2NC000001/command/charge_start",
+		"tesla-ble//command/charge_start",
+	} {
+		if _, _, ok := parseCommandTopic("tesla-ble", topic); ok {
+			t.Errorf("topic %s should not be a command topic", topic)
+		}
+	}
+}
+
+func TestDiscoveryLimitedToKeyRole(t *testing.T) {
+	config.AppConfig = &config.Config{MqttScopes: []string{auth.ScopeAdmin}}
+	published := func(role string) []string {
+		keys := []string{}
+		for _, e := range entities {
+			if e.allowed(role) {
+				keys = append(keys, e.key)
+			}
+		}
+		return keys
+	}
+
+	chargingManager := published(control.KeyRoleChargingManager)
+	for _, key := range []string{"battery_level", "charging", "charging_amps"} {
+		if !slices.Contains(chargingManager, key) {
+			t.Errorf("expected %s for the charging manager role", key)
+		}
+	}
+	for _, key := range []string{"climate", "sentry", "lock"} {
+		if slices.Contains(chargingManager, key) {
+			t.Errorf("did not expect %s for the charging manager role", key)
+		}
+	}
+	if owner := published(control.KeyRoleOwner); len(owner) != len(entities) {
+		t.Errorf("expected all entities for the owner role, got %v", owner)
+	}
+
+	// The entities of commands with scopes that are not allowed via MQTT are removed as well
+	config.AppConfig = &config.Config{MqttScopes: []string{auth.ScopeRead, auth.ScopeCharge, auth.ScopeClimate}}
+	owner := published(control.KeyRoleOwner)
+	if !slices.Contains(owner, "climate") || slices.Contains(owner, "lock") || slices.Contains(owner, "sentry") {
+		t.Errorf("expected the lock and sentry mode to be removed, got %v", owner)
+	}
+}
+
+func TestPushCommandChecksScope(t *testing.T) {
+	config.AppConfig = &config.Config{MqttScopes: []string{auth.ScopeRead, auth.ScopeCharge, auth.ScopeClimate}}
+	previous := control.BleControlInstance
+	control.BleControlInstance = &control.BleControl{}
+	defer func() {
+		control.BleControlInstance = previous
+	}()
+
+	c := &Client{prefix: "tesla-ble"}
+	for _, command := range []string{"door_unlock", "remote_start_drive", "set_pin_to_drive"} {
+		if err := c.pushCommand("LRW3E7FS2NC000001", command, nil); err == nil || !strings.Contains(err.Error(), "mqttScopes") {
+			t.Errorf("expected %s to be rejected because of its scope, got %v", command, err)
+		}
+	}
+}
+
+func TestDiscoveryConfig(t *testing.T) {
+	config.AppConfig = &config.Config{MqttDiscoveryPrefix: "homeassistant"}
+	c := &Client{prefix: "tesla-ble"}
+
+	for _, e := range entities {
+		discovery := c.discoveryConfig("VIN1", e)
+		switch e.key {
+		case "charging_amps":
+			if discovery["command_topic"] != "tesla-ble/VIN1/command/set_charging_amps" || discovery["state_topic"] != "tesla-ble/VIN1/vehicle_data/charge_state" {
+				t.Errorf("unexpected topics %v", discovery)
+			}
+		case "lock":
+			if discovery["command_topic"] != "tesla-ble/VIN1/set/lock" || discovery["state_topic"] != "tesla-ble/VIN1/body_controller_state" {
+				t.Errorf("unexpected topics %v", discovery)
+			}
+		case "awake":
+			if discovery["state_topic"] != "tesla-ble/VIN1/sleep_state" {
+				t.Errorf("unexpected state topic %v", discovery["state_topic"])
+			}
+		}
+		if topic := discoveryTopic("VIN1", e); topic != "homeassistant/"+e.component+"/tesla_ble_vin1/"+e.key+"/config" {
+			t.Errorf("unexpected discovery topic %s", topic)
+		}
+	}
+	for _, e := range entities {
+		if _, ok := toggles[e.key]; (e.component == "switch" || e.component == "lock") && !ok {
+			t.Errorf("entity %s has no toggle", e.key)
+		}
+	}
+}
+
+func TestDiscoveryMaxChargingAmps(t *testing.T) {
+	config.AppConfig = &config.Config{MqttDiscoveryPrefix: "homeassistant"}
+	c := &Client{prefix: "tesla-ble", maxChargingAmps: map[string]int{"VIN1": 32}}
+
+	for _, e := range entities {
+		if e.key != "charging_amps" {
+			continue
+		}
+		if maxAmps := c.discoveryConfig("VIN1", e)["max"]; maxAmps != 32 {
+			t.Errorf("expected the maximum of the vehicle, got %v", maxAmps)
+		}
+		if maxAmps := c.discoveryConfig("VIN2", e)["max"]; maxAmps != defaultMaxChargingAmps {
+			t.Errorf("expected the default maximum, got %v", maxAmps)
+		}
+	}
+}
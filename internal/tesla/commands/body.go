@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// dayNamesBitMask maps the day names of the Fleet API days_of_week parameter to their bits
+var dayNamesBitMask = map[string]int32{
+	"SUN":       1,
+	"SUNDAY":    1,
+	"MON":       2,
+	"MONDAY":    2,
+	"TUE":       4,
+	"TUES":      4,
+	"TUESDAY":   4,
+	"WED":       8,
+	"WEDNESDAY": 8,
+	"THU":       16,
+	"THURS":     16,
+	"THURSDAY":  16,
+	"FRI":       32,
+	"FRIDAY":    32,
+	"SAT":       64,
+	"SATURDAY":  64,
+	"ALL":       127,
+	"WEEKDAYS":  62,
+}
+
+// secretBodyKeys are the body values that must not be logged or shown, e.g. the PIN of the speed limit
+var secretBodyKeys = []string{"pin", "password"}
+
+// RedactBody returns a copy of the body with the secret values masked, for logs and API responses
+func RedactBody(body map[string]interface{}) map[string]interface{} {
+	if body == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(body))
+	for key, value := range body {
+		if slices.Contains(secretBodyKeys, strings.ToLower(key)) {
+			value = "***"
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// getBool reads a bool from the request body. Like the other body values, it may be sent as string.
+func (command *Command) getBool(key string, required bool) (bool, error) {
+	switch v := command.Body[key].(type) {
+	case bool:
+		return v, nil
+	case string:
+		value, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("%s parsing error: %s", key, err)
+		}
+		return value, nil
+	case nil:
+		if required {
+			return false, fmt.Errorf("%s missing in body", key)
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s parsing error: unexpected type %T", key, v)
+	}
+}
+
+// getNumber reads a number from the request body. It may be sent as JSON number or as string.
+func (command *Command) getNumber(key string, required bool) (float64, error) {
+	switch v := command.Body[key].(type) {
+	case float64:
+		return v, nil
+	case string:
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s parsing error: %s", key, err)
+		}
+		return value, nil
+	case nil:
+		if required {
+			return 0, fmt.Errorf("%s missing in body", key)
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%s parsing error: unexpected type %T", key, v)
+	}
+}
+
+// getString reads a string from the request body.
+func (command *Command) getString(key string, required bool) (string, error) {
+	switch v := command.Body[key].(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		if required {
+			return "", fmt.Errorf("%s missing in body", key)
+		}
+		return "", nil
+	default:
+		return "", fmt.Errorf("%s parsing error: unexpected type %T", key, v)
+	}
+}
+
+// getDays reads the days of week either as bit mask or as comma separated day names (e.g. "Mon,Tue" or "All").
+func (command *Command) getDays(key string, required bool) (int32, error) {
+	if mask, ok := command.Body[key].(float64); ok {
+		return int32(mask), nil
+	}
+	days, err := command.getString(key, required)
+	if err != nil || days == "" {
+		return 0, err
+	}
+	if mask, err := strconv.ParseInt(days, 10, 32); err == nil {
+		return int32(mask), nil
+	}
+
+	var mask int32
+	for _, day := range strings.Split(days, ",") {
+		bit, ok := dayNamesBitMask[strings.ToUpper(strings.TrimSpace(day))]
+		if !ok {
+			return 0, fmt.Errorf("%s parsing error: unrecognized day name %s", key, day)
+		}
+		mask |= bit
+	}
+	return mask, nil
+}
+
+// getTimeAfterMidnight reads a time given in minutes after midnight.
+func (command *Command) getTimeAfterMidnight(key string, required bool) (time.Duration, error) {
+	minutes, err := command.getNumber(key, required)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// getPolicy reads a charging policy from an enabled and a weekdays only flag.
+func (command *Command) getPolicy(enabledKey string, weekdaysOnlyKey string) (vehicle.ChargingPolicy, error) {
+	enabled, err := command.getBool(enabledKey, false)
+	if err != nil {
+		return vehicle.ChargingPolicyOff, err
+	}
+	weekdaysOnly, err := command.getBool(weekdaysOnlyKey, false)
+	if err != nil {
+		return vehicle.ChargingPolicyOff, err
+	}
+	if weekdaysOnly {
+		return vehicle.ChargingPolicyWeekdays, nil
+	}
+	if enabled {
+		return vehicle.ChargingPolicyAllDays, nil
+	}
+	return vehicle.ChargingPolicyOff, nil
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+)
+
+// closureWaitTimeout is the maximum time to wait for a closure to reach its new position.
+// The command is in flight while waiting, so the other commands of the vehicle wait as well.
+const closureWaitTimeout = 20 * time.Second
+
+// sunRoofOpenMinPercent is the smallest position that counts as open, the comfort position
+// of some vehicles is below 100 percent and the vent position differs between vehicles
+const sunRoofOpenMinPercent = 50
+
+// closurePollInterval is the time between two reads of the closure status
+const closurePollInterval = 1 * time.Second
+
+// waitsForResult returns true if the caller waits for the result of the command (wait=true)
+func (command *Command) waitsForResult() bool {
+	return command.Response != nil && command.Response.Wait != nil
+}
+
+func isClosureOpen(state vcsec.ClosureState_E) bool {
+	return state == vcsec.ClosureState_E_CLOSURESTATE_OPEN || state == vcsec.ClosureState_E_CLOSURESTATE_AJAR
+}
+
+func isClosureClosed(state vcsec.ClosureState_E) bool {
+	return state == vcsec.ClosureState_E_CLOSURESTATE_CLOSED
+}
+
+// sunRoofReached returns true if the reported position of the sunroof matches the requested state
+func sunRoofReached(state string, percentOpen int32) bool {
+	switch state {
+	case "close":
+		return percentOpen == 0
+	case "vent":
+		return percentOpen > 0 && percentOpen < sunRoofOpenMinPercent
+	default:
+		return percentOpen >= sunRoofOpenMinPercent
+	}
+}
+
+// waitForBodyControllerState re-reads the closure statuses (VCSEC) until reached returns true.
+// The last body controller state is returned as response of the command.
+func (command *Command) waitForBodyControllerState(ctx context.Context, car *vehicle.Vehicle, reached func(*vcsec.ClosureStatuses) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, closureWaitTimeout)
+	defer cancel()
+
+	for {
+		vs, err := car.BodyControllerState(ctx)
+		if err == nil {
+			if reached(vs.GetClosureStatuses()) {
+				return command.setClosureResponse(models.VehicleStatusFromBle(vs))
+			}
+			logging.Debug("Closure has not reached the new position yet", "Command", command.Command, "ClosureStatuses", vs.GetClosureStatuses())
+		} else {
+			logging.Debug("Failed to read body controller state", "Error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("closure did not reach the new position: %s", ctx.Err())
+		case <-time.After(closurePollInterval):
+		}
+	}
+}
+
+// waitForClosuresState re-reads the closures state (Infotainment) until reached returns true.
+// The last closures state is returned as response of the command.
+func (command *Command) waitForClosuresState(ctx context.Context, car *vehicle.Vehicle, reached func(*carserver.ClosuresState) bool) error {
+	ctx, cancel := context.WithTimeout(ctx, closureWaitTimeout)
+	defer cancel()
+
+	for {
+		data, err := car.GetState(ctx, vehicle.StateCategoryClosures)
+		if err == nil {
+			if reached(data.GetClosuresState()) {
+				return command.setClosureResponse(models.ClosuresStateFromBle(data))
+			}
+			logging.Debug("Closure has not reached the new position yet", "Command", command.Command)
+		} else {
+			logging.Debug("Failed to read closures state", "Error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("closure did not reach the new position: %s", ctx.Err())
+		case <-time.After(closurePollInterval):
+		}
+	}
+}
+
+func (command *Command) setClosureResponse(state interface{}) error {
+	stateJson, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal closure state: %s", err)
+	}
+	command.Response.Response = stateJson
+	return nil
+}
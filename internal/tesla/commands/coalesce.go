@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// idempotentSetterCommands only depend on the newest body, so a queued command can be replaced by a newer one
+var idempotentSetterCommands = []string{"set_charging_amps", "set_charge_limit", "set_temps", "set_preconditioning_max", "set_sentry_mode", "set_climate_keeper_mode", "set_cabin_overheat_protection", "set_bioweapon_mode", "set_scheduled_charging", "set_scheduled_departure", "speed_limit_set_limit", "adjust_volume"}
+
+// CanCoalesce returns true if the command can replace the queued command instead of being queued separately.
+// Idempotent setters are last-writer-wins, low priority reads are merged.
+func (command *Command) CanCoalesce(queued *Command) bool {
+	if command.Vin != queued.Vin || command.Command != queued.Command {
+		return false
+	}
+	if command.Command == "vehicle_data" {
+		return command.Priority == PriorityLow && queued.Priority == PriorityLow &&
+			command.Response != nil && queued.Response != nil
+	}
+	return slices.Contains(idempotentSetterCommands, command.Command)
+}
+
+// Coalesce merges the queued command into this newer command, which replaces it in the queue.
+// The newest body is sent (reads get the endpoints of both) and all waiting callers get the same result.
+func (command *Command) Coalesce(queued *Command) {
+	// Keep the original requests, so that a single one can be detached again
+	if command.Coalesced == nil {
+		request := *command
+		command.Coalesced = []*Command{&request}
+	}
+	command.Coalesced = append(queued.requests(), command.Coalesced...)
+
+	if command.Command == "vehicle_data" {
+		endpoints, _ := queued.Body["endpoints"].([]string)
+		endpoints = slices.Clone(endpoints)
+		newEndpoints, _ := command.Body["endpoints"].([]string)
+		for _, endpoint := range newEndpoints {
+			if !slices.Contains(endpoints, endpoint) {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+		command.Body = map[string]interface{}{"endpoints": endpoints}
+	}
+	command.AutoWakeup = command.AutoWakeup || queued.AutoWakeup
+	command.Priority = max(command.Priority, queued.Priority)
+	// The merged command waits as long as the most patient request
+	if command.ExpiresAt.IsZero() || queued.ExpiresAt.IsZero() {
+		command.ExpiresAt = time.Time{}
+	} else if queued.ExpiresAt.After(command.ExpiresAt) {
+		command.ExpiresAt = queued.ExpiresAt
+	}
+}
+
+// Detach removes the request with the job id from a coalesced command.
+// Returns the detached request and the command merged from the remaining requests, nil if the command was not coalesced.
+func (command *Command) Detach(jobId string) (detached *Command, remaining *Command) {
+	i := slices.IndexFunc(command.Coalesced, func(request *Command) bool {
+		return request.JobId == jobId
+	})
+	if i < 0 || len(command.Coalesced) < 2 {
+		return nil, nil
+	}
+	requests := slices.Delete(slices.Clone(command.Coalesced), i, i+1)
+	remaining = requests[0]
+	for _, request := range requests[1:] {
+		newer := *request
+		newer.Coalesce(remaining)
+		remaining = &newer
+	}
+	return command.Coalesced[i], remaining
+}
+
+// requests returns the original requests merged into the command, oldest first
+func (command *Command) requests() []*Command {
+	if command.Coalesced == nil {
+		return []*Command{command}
+	}
+	return slices.Clone(command.Coalesced)
+}
+
+// Context returns the context the command is executed with, nil if a request has no waiting caller and must be executed in any case.
+// The context of a coalesced command ends when the contexts of all waiting callers have ended.
+func (command *Command) Context() (context.Context, context.CancelFunc) {
+	var contexts []context.Context
+	for _, request := range command.requests() {
+		if request.Response == nil || request.Response.Ctx == nil {
+			return nil, func() {}
+		}
+		contexts = append(contexts, request.Response.Ctx)
+	}
+	if len(contexts) == 1 {
+		return contexts[0], func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, waiter := range contexts {
+			select {
+			case <-waiter.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// Complete sets the result of the command and of all coalesced requests and releases the waiting callers
+func (command *Command) Complete(err error) {
+	var result json.RawMessage
+	if command.Response != nil {
+		result = command.Response.Response
+	}
+	for _, request := range command.requests() {
+		response := request.Response
+		if response == nil {
+			continue
+		}
+		if err != nil {
+			response.Error = err.Error()
+			response.Result = false
+		} else {
+			response.Result = true
+			response.Response = result
+		}
+		if response.Wait != nil {
+			response.Wait.Done()
+		}
+	}
+}
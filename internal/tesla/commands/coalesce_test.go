@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
+)
+
+func TestCoalescedContextEndsWithLastWaiter(t *testing.T) {
+	olderCtx, cancelOlder := context.WithCancel(context.Background())
+	newerCtx, cancelNewer := context.WithCancel(context.Background())
+	defer cancelOlder()
+	defer cancelNewer()
+
+	command := &Command{Command: "vehicle_data", Vin: "VIN", Priority: PriorityLow, Response: &models.ApiResponse{Ctx: newerCtx}}
+	command.Coalesce(&Command{Command: "vehicle_data", Vin: "VIN", Priority: PriorityLow, Response: &models.ApiResponse{Ctx: olderCtx}})
+
+	ctx, cancel := command.Context()
+	defer cancel()
+
+	cancelNewer()
+	select {
+	case <-ctx.Done():
+		t.Fatal("expected the context to continue while the older caller waits")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancelOlder()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the context to end when all callers are gone")
+	}
+}
+
+func TestCoalescedContextWithoutWaiter(t *testing.T) {
+	command := &Command{Command: "set_charging_amps", Vin: "VIN", Response: &models.ApiResponse{Ctx: context.Background()}}
+	command.Coalesce(&Command{Command: "set_charging_amps", Vin: "VIN"})
+
+	if ctx, _ := command.Context(); ctx != nil {
+		t.Errorf("expected no caller context for a request that must be executed in any case")
+	}
+}
+
+func TestDetachNewestRequest(t *testing.T) {
+	older := &Command{Command: "set_charging_amps", Vin: "VIN", JobId: "older", Body: map[string]interface{}{"charging_amps": 8}, Priority: PriorityNormal}
+	command := &Command{Command: "set_charging_amps", Vin: "VIN", JobId: "newer", Body: map[string]interface{}{"charging_amps": 16}, Priority: PriorityHigh}
+	command.Coalesce(older)
+
+	if detached, _ := (&Command{JobId: "single"}).Detach("single"); detached != nil {
+		t.Errorf("a command that was not coalesced cannot be detached")
+	}
+
+	detached, remaining := command.Detach("newer")
+	if detached == nil || detached.JobId != "newer" {
+		t.Fatalf("expected the newer request to be detached, got %v", detached)
+	}
+	if remaining.JobId != "older" || remaining.Body["charging_amps"] != 8 || remaining.Priority != PriorityNormal {
+		t.Errorf("expected the older request to remain unchanged, got %+v", remaining)
+	}
+	if ids := remaining.JobIds(); len(ids) != 1 || ids[0] != "older" {
+		t.Errorf("expected only the older job, got %v", ids)
+	}
+}
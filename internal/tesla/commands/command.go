@@ -2,7 +2,9 @@ package commands
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
@@ -20,6 +22,17 @@ var Domain = struct {
 	Infotainment: "infotainment",
 }
 
+// vcsecCommands only need the body controller (VCSEC), so they do not wake the vehicle
+var vcsecCommands = []string{"body-controller-state"}
+
+// CommandDomain returns the domain the command is sent to
+func CommandDomain(command string) DomainType {
+	if slices.Contains(vcsecCommands, command) {
+		return Domain.VCSEC
+	}
+	return Domain.None
+}
+
 type Command struct {
 	Command    string
 	Domain     DomainType
@@ -27,6 +40,36 @@ type Command struct {
 	Body       map[string]interface{}
 	Response   *models.ApiResponse
 	AutoWakeup bool
+	Priority   Priority
+	JobId      string
+	// The command is dropped if it is not executed before, zero never expires
+	ExpiresAt time.Time
+	// Original requests merged into this command (including its own, oldest first), they get the result of this command.
+	// Nil if nothing was coalesced.
+	Coalesced []*Command
+}
+
+// JobIds returns the job id of the command and of all coalesced commands
+func (command *Command) JobIds() []string {
+	var ids []string
+	for _, request := range command.requests() {
+		if request.JobId != "" {
+			ids = append(ids, request.JobId)
+		}
+	}
+	return ids
+}
+
+// CoalescedJobIds returns the job ids of the coalesced commands without the command's own job id
+func (command *Command) CoalescedJobIds() []string {
+	return slices.DeleteFunc(command.JobIds(), func(id string) bool {
+		return id == command.JobId
+	})
+}
+
+// HasJob returns true if the job belongs to the command or to one of its coalesced commands
+func (command *Command) HasJob(jobId string) bool {
+	return slices.Contains(command.JobIds(), jobId)
 }
 
 // 'charge_state', 'climate_state', 'closures_state', 'drive_state', 'gui_settings', 'location_data', 'charge_schedule_data', 'preconditioning_schedule_data', 'vehicle_config', 'vehicle_state', 'vehicle_data_combo'
@@ -40,6 +83,7 @@ var categoriesByName = map[string]vehicle.StateCategory{
 	"tire-pressure":         vehicle.StateCategoryTirePressure,
 	"media":                 vehicle.StateCategoryMedia,
 	"media-detail":          vehicle.StateCategoryMediaDetail,
+	"location":              vehicle.StateCategoryLocation,
 	"software-update":       vehicle.StateCategorySoftwareUpdate,
 	"parental-controls":     vehicle.StateCategoryParentalControls,
 }
@@ -50,3 +94,51 @@ func GetCategory(nameStr string) (vehicle.StateCategory, error) {
 	}
 	return 0, fmt.Errorf("unrecognized state category '%s'", nameStr)
 }
+
+// fleetEndpointsByName maps the Fleet API endpoint names to the category names they are composed of
+var fleetEndpointsByName = map[string][]string{
+	"drive_state":                   {"drive", "location"},
+	"location_data":                 {"location"},
+	"vehicle_state":                 {"closures_state", "drive", "tire-pressure", "software-update"},
+	"gui_settings":                  {},
+	"vehicle_config":                {"closures_state"},
+	"charge_schedule_data":          {"charge-schedule"},
+	"preconditioning_schedule_data": {"precondition-schedule"},
+}
+
+// GetCategoryNames translates an endpoint name into the category names needed to build it.
+// Category names from categoriesByName are returned unchanged. The endpoint must be normalized by ExpandEndpoints.
+func GetCategoryNames(endpoint string) ([]string, error) {
+	if names, ok := fleetEndpointsByName[endpoint]; ok {
+		return names, nil
+	}
+	if _, ok := categoriesByName[endpoint]; ok {
+		return []string{endpoint}, nil
+	}
+	return nil, fmt.Errorf("unrecognized state category '%s'", endpoint)
+}
+
+// NeedsBodyControllerState returns true if the endpoint is composed with the body controller state
+func NeedsBodyControllerState(endpoint string) bool {
+	return endpoint == "vehicle_state"
+}
+
+// ExpandEndpoints normalizes the endpoint names to lower case, replaces vehicle_data_combo with all endpoints
+// of the Fleet API vehicle_data response and removes duplicates. Every endpoint name passes here first,
+// so the rest of the code only compares lower case names.
+func ExpandEndpoints(endpoints []string) []string {
+	expanded := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpoint = strings.ToLower(strings.TrimSpace(endpoint))
+		if endpoint == "vehicle_data_combo" {
+			for _, comboEndpoint := range VehicleDataComboEndpoints {
+				if !slices.Contains(expanded, comboEndpoint) {
+					expanded = append(expanded, comboEndpoint)
+				}
+			}
+		} else if !slices.Contains(expanded, endpoint) {
+			expanded = append(expanded, endpoint)
+		}
+	}
+	return expanded
+}
@@ -6,18 +6,24 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 	"github.com/wimaha/TeslaBleHttpProxy/config"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/api/models"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"google.golang.org/protobuf/proto"
 )
 
-var ExceptedCommands = []string{"vehicle_data", "auto_conditioning_start", "auto_conditioning_stop", "charge_port_door_open", "charge_port_door_close", "flash_lights", "wake_up", "set_charging_amps", "set_charge_limit", "charge_start", "charge_stop", "session_info", "honk_horn", "door_lock", "door_unlock", "set_sentry_mode"}
-var ExceptedEndpoints = []string{"charge_state", "climate_state"}
+var ExceptedCommands = []string{"vehicle_data", "auto_conditioning_start", "auto_conditioning_stop", "charge_port_door_open", "charge_port_door_close", "flash_lights", "wake_up", "set_charging_amps", "set_charge_limit", "charge_start", "charge_stop", "session_info", "honk_horn", "door_lock", "door_unlock", "set_sentry_mode", "set_temps", "set_preconditioning_max", "remote_seat_heater_request", "remote_seat_cooler_request", "remote_steering_wheel_heater_request", "set_climate_keeper_mode", "set_cabin_overheat_protection", "set_bioweapon_mode", "set_scheduled_charging", "set_scheduled_departure", "add_charge_schedule", "remove_charge_schedule", "add_precondition_schedule", "remove_precondition_schedule", "actuate_trunk", "window_control", "sun_roof_control", "open_tonneau", "close_tonneau", "stop_tonneau", "set_valet_mode", "speed_limit_activate", "speed_limit_deactivate", "speed_limit_set_limit", "set_pin_to_drive", "guest_mode", "remote_start_drive", "media_toggle_playback", "media_next_track", "media_prev_track", "media_next_fav", "media_prev_fav", "media_volume_up", "media_volume_down", "adjust_volume", "schedule_software_update", "cancel_software_update"}
+var ExceptedEndpoints = []string{"charge_state", "climate_state", "drive", "closures_state", "charge-schedule", "precondition-schedule", "tire-pressure", "media", "media-detail", "software-update", "parental-controls", "location", "drive_state", "vehicle_state", "location_data", "gui_settings", "vehicle_config", "charge_schedule_data", "preconditioning_schedule_data"}
+
+// VehicleDataComboEndpoints are the sections of a full Fleet API vehicle_data response
+var VehicleDataComboEndpoints = []string{"charge_state", "climate_state", "drive_state", "gui_settings", "vehicle_config", "vehicle_state", "charge_schedule_data", "preconditioning_schedule_data"}
 
 func (command *Command) Send(ctx context.Context, car *vehicle.Vehicle) (shouldRetry bool, err error) {
 	switch command.Command {
@@ -29,6 +35,128 @@ func (command *Command) Send(ctx context.Context, car *vehicle.Vehicle) (shouldR
 		if err := car.ClimateOff(ctx); err != nil {
 			return true, fmt.Errorf("failed to stop auto conditioning: %s", err)
 		}
+	case "set_temps":
+		driverTemp, err := command.getNumber("driver_temp", true)
+		if err != nil {
+			return false, err
+		}
+		passengerTemp, err := command.getNumber("passenger_temp", false)
+		if err != nil {
+			return false, err
+		}
+		if _, ok := command.Body["passenger_temp"]; !ok {
+			passengerTemp = driverTemp
+		}
+		if err := car.ChangeClimateTemp(ctx, float32(driverTemp), float32(passengerTemp)); err != nil {
+			return true, fmt.Errorf("failed to set temperatures: %s", err)
+		}
+	case "set_preconditioning_max":
+		on, err := command.getBool("on", true)
+		if err != nil {
+			return false, err
+		}
+		manualOverride, err := command.getBool("manual_override", false)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SetPreconditioningMax(ctx, on, manualOverride); err != nil {
+			return true, fmt.Errorf("failed to set preconditioning max: %s", err)
+		}
+	case "remote_seat_heater_request":
+		// Fleet API seat positions: 0 front left, 1 front right, 2 rear left, 3 rear left back,
+		// 4 rear center, 5 rear right, 6 rear right back, 7 third row left, 8 third row right
+		seatPosition, err := command.getNumber("seat_position", true)
+		if err != nil {
+			return false, err
+		}
+		if seatPosition < 0 || seatPosition > 8 {
+			return false, fmt.Errorf("invalid seat position: %v", seatPosition)
+		}
+		level, err := command.getNumber("level", true)
+		if err != nil {
+			return false, err
+		}
+		if level < 0 || level > 3 {
+			return false, fmt.Errorf("invalid level: %v", level)
+		}
+		seat := vehicle.SeatPosition(seatPosition) + vehicle.SeatFrontLeft
+		if err := car.SetSeatHeater(ctx, map[vehicle.SeatPosition]vehicle.Level{seat: vehicle.Level(level)}); err != nil {
+			return true, fmt.Errorf("failed to set seat heater: %s", err)
+		}
+	case "remote_seat_cooler_request":
+		// Fleet API seat positions: 1 front left, 2 front right
+		// Fleet API cooler levels: 1 off, 2 low, 3 medium, 4 high
+		seatPosition, err := command.getNumber("seat_position", true)
+		if err != nil {
+			return false, err
+		}
+		var seat vehicle.SeatPosition
+		switch seatPosition {
+		case 1:
+			seat = vehicle.SeatFrontLeft
+		case 2:
+			seat = vehicle.SeatFrontRight
+		default:
+			return false, fmt.Errorf("invalid seat position: %v", seatPosition)
+		}
+		level, err := command.getNumber("seat_cooler_level", true)
+		if err != nil {
+			return false, err
+		}
+		if level < 1 || level > 4 {
+			return false, fmt.Errorf("invalid seat cooler level: %v", level)
+		}
+		if err := car.SetSeatCooler(ctx, vehicle.Level(level-1), seat); err != nil {
+			return true, fmt.Errorf("failed to set seat cooler: %s", err)
+		}
+	case "remote_steering_wheel_heater_request":
+		on, err := command.getBool("on", true)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SetSteeringWheelHeater(ctx, on); err != nil {
+			return true, fmt.Errorf("failed to set steering wheel heater: %s", err)
+		}
+	case "set_climate_keeper_mode":
+		// 0 off, 1 on, 2 dog, 3 camp
+		mode, err := command.getNumber("climate_keeper_mode", true)
+		if err != nil {
+			return false, err
+		}
+		if mode < 0 || mode > 3 {
+			return false, fmt.Errorf("invalid climate keeper mode: %v", mode)
+		}
+		manualOverride, err := command.getBool("manual_override", false)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SetClimateKeeperMode(ctx, vehicle.ClimateKeeperMode(mode), manualOverride); err != nil {
+			return true, fmt.Errorf("failed to set climate keeper mode: %s", err)
+		}
+	case "set_cabin_overheat_protection":
+		on, err := command.getBool("on", true)
+		if err != nil {
+			return false, err
+		}
+		fanOnly, err := command.getBool("fan_only", false)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SetCabinOverheatProtection(ctx, on, fanOnly); err != nil {
+			return true, fmt.Errorf("failed to set cabin overheat protection: %s", err)
+		}
+	case "set_bioweapon_mode":
+		on, err := command.getBool("on", true)
+		if err != nil {
+			return false, err
+		}
+		manualOverride, err := command.getBool("manual_override", false)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SetBioweaponDefenseMode(ctx, on, manualOverride); err != nil {
+			return true, fmt.Errorf("failed to set bioweapon defense mode: %s", err)
+		}
 	case "charge_port_door_open":
 		if err := car.ChargePortOpen(ctx); err != nil {
 			return true, fmt.Errorf("failed to open charge port: %s", err)
@@ -37,6 +165,249 @@ func (command *Command) Send(ctx context.Context, car *vehicle.Vehicle) (shouldR
 		if err := car.ChargePortClose(ctx); err != nil {
 			return true, fmt.Errorf("failed to close charge port: %s", err)
 		}
+	case "actuate_trunk":
+		whichTrunk, err := command.getString("which_trunk", true)
+		if err != nil {
+			return false, err
+		}
+		switch whichTrunk {
+		case "front":
+			if err := car.OpenFrunk(ctx); err != nil {
+				return true, fmt.Errorf("failed to open frunk: %s", err)
+			}
+			if command.waitsForResult() {
+				// Confirm the new position, a failed confirmation must not repeat the command
+				if err := command.waitForBodyControllerState(ctx, car, func(cs *vcsec.ClosureStatuses) bool {
+					return isClosureOpen(cs.GetFrontTrunk())
+				}); err != nil {
+					return false, err
+				}
+			}
+		case "rear":
+			// The rear trunk toggles, so the current position is needed to confirm the new one
+			var wasClosed bool
+			if command.waitsForResult() {
+				vs, err := car.BodyControllerState(ctx)
+				if err != nil {
+					return true, fmt.Errorf("failed to get body controller state: %s", err)
+				}
+				wasClosed = isClosureClosed(vs.GetClosureStatuses().GetRearTrunk())
+			}
+			if err := car.ActuateTrunk(ctx); err != nil {
+				return true, fmt.Errorf("failed to actuate trunk: %s", err)
+			}
+			if command.waitsForResult() {
+				if err := command.waitForBodyControllerState(ctx, car, func(cs *vcsec.ClosureStatuses) bool {
+					if wasClosed {
+						return isClosureOpen(cs.GetRearTrunk())
+					}
+					return isClosureClosed(cs.GetRearTrunk())
+				}); err != nil {
+					return false, err
+				}
+			}
+		default:
+			return false, fmt.Errorf("which_trunk must be 'front' or 'rear'")
+		}
+	case "window_control":
+		windowCommand, err := command.getString("command", true)
+		if err != nil {
+			return false, err
+		}
+		switch windowCommand {
+		case "vent":
+			if err := car.VentWindows(ctx); err != nil {
+				return true, fmt.Errorf("failed to vent windows: %s", err)
+			}
+		case "close":
+			if err := car.CloseWindows(ctx); err != nil {
+				return true, fmt.Errorf("failed to close windows: %s", err)
+			}
+		default:
+			return false, fmt.Errorf("command must be 'vent' or 'close'")
+		}
+		if command.waitsForResult() {
+			if err := command.waitForClosuresState(ctx, car, func(cs *carserver.ClosuresState) bool {
+				anyOpen := cs.GetWindowOpenDriverFront() || cs.GetWindowOpenPassengerFront() || cs.GetWindowOpenDriverRear() || cs.GetWindowOpenPassengerRear()
+				return anyOpen == (windowCommand == "vent")
+			}); err != nil {
+				return false, err
+			}
+		}
+	case "sun_roof_control":
+		state, err := command.getString("state", true)
+		if err != nil {
+			return false, err
+		}
+		var level int32
+		switch state {
+		case "close":
+			level = 0
+		case "vent":
+			level = 15
+		case "open":
+			level = 100
+		default:
+			return false, fmt.Errorf("state must be 'vent', 'open' or 'close'")
+		}
+		if err := car.ChangeSunroofState(ctx, level); err != nil {
+			return true, fmt.Errorf("failed to %s sunroof: %s", state, err)
+		}
+		if command.waitsForResult() {
+			if err := command.waitForClosuresState(ctx, car, func(cs *carserver.ClosuresState) bool {
+				return sunRoofReached(state, cs.GetSunRoofPercentOpen())
+			}); err != nil {
+				return false, err
+			}
+		}
+	case "open_tonneau":
+		if err := car.OpenTonneau(ctx); err != nil {
+			return true, fmt.Errorf("failed to open tonneau: %s", err)
+		}
+		if command.waitsForResult() {
+			if err := command.waitForBodyControllerState(ctx, car, func(cs *vcsec.ClosureStatuses) bool {
+				return isClosureOpen(cs.GetTonneau())
+			}); err != nil {
+				return false, err
+			}
+		}
+	case "close_tonneau":
+		if err := car.CloseTonneau(ctx); err != nil {
+			return true, fmt.Errorf("failed to close tonneau: %s", err)
+		}
+		if command.waitsForResult() {
+			if err := command.waitForBodyControllerState(ctx, car, func(cs *vcsec.ClosureStatuses) bool {
+				return isClosureClosed(cs.GetTonneau())
+			}); err != nil {
+				return false, err
+			}
+		}
+	case "stop_tonneau":
+		if err := car.StopTonneau(ctx); err != nil {
+			return true, fmt.Errorf("failed to stop tonneau: %s", err)
+		}
+	case "set_valet_mode":
+		on, err := command.getBool("on", true)
+		if err != nil {
+			return false, err
+		}
+		if on {
+			password, err := command.getString("password", false)
+			if err != nil {
+				return false, err
+			}
+			if err := car.EnableValetMode(ctx, password); err != nil {
+				return true, fmt.Errorf("failed to enable valet mode: %s", err)
+			}
+		} else {
+			if err := car.DisableValetMode(ctx); err != nil {
+				return true, fmt.Errorf("failed to disable valet mode: %s", err)
+			}
+		}
+	case "speed_limit_activate":
+		pin, err := command.getString("pin", true)
+		if err != nil {
+			return false, err
+		}
+		// Commands that check a PIN or password are not retried, a wrong one would count as several
+		// failed attempts and can lock the PIN on the vehicle
+		if err := car.ActivateSpeedLimit(ctx, pin); err != nil {
+			return false, fmt.Errorf("failed to activate speed limit: %s", err)
+		}
+	case "speed_limit_deactivate":
+		pin, err := command.getString("pin", true)
+		if err != nil {
+			return false, err
+		}
+		if err := car.DeactivateSpeedLimit(ctx, pin); err != nil {
+			return false, fmt.Errorf("failed to deactivate speed limit: %s", err)
+		}
+	case "speed_limit_set_limit":
+		limitMph, err := command.getNumber("limit_mph", true)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SpeedLimitSetLimitMPH(ctx, limitMph); err != nil {
+			return true, fmt.Errorf("failed to set speed limit: %s", err)
+		}
+	case "set_pin_to_drive":
+		on, err := command.getBool("on", true)
+		if err != nil {
+			return false, err
+		}
+		password, err := command.getString("password", false)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SetPINToDrive(ctx, on, password); err != nil {
+			return false, fmt.Errorf("failed to set PIN to drive: %s", err)
+		}
+	case "guest_mode":
+		enable, err := command.getBool("enable", true)
+		if err != nil {
+			return false, err
+		}
+		if err := car.SetGuestMode(ctx, enable); err != nil {
+			return true, fmt.Errorf("failed to set guest mode: %s", err)
+		}
+	case "remote_start_drive":
+		if err := car.RemoteDrive(ctx); err != nil {
+			return true, fmt.Errorf("failed to start remote drive: %s", err)
+		}
+	case "media_toggle_playback":
+		if err := car.ToggleMediaPlayback(ctx); err != nil {
+			return true, fmt.Errorf("failed to toggle media playback: %s", err)
+		}
+	case "media_next_track":
+		if err := car.MediaNextTrack(ctx); err != nil {
+			return true, fmt.Errorf("failed to skip to next track: %s", err)
+		}
+	case "media_prev_track":
+		if err := car.MediaPreviousTrack(ctx); err != nil {
+			return true, fmt.Errorf("failed to skip to previous track: %s", err)
+		}
+	case "media_next_fav":
+		if err := car.MediaNextFavorite(ctx); err != nil {
+			return true, fmt.Errorf("failed to skip to next favorite: %s", err)
+		}
+	case "media_prev_fav":
+		if err := car.MediaPreviousFavorite(ctx); err != nil {
+			return true, fmt.Errorf("failed to skip to previous favorite: %s", err)
+		}
+	case "media_volume_up":
+		if err := car.VolumeUp(ctx); err != nil {
+			return true, fmt.Errorf("failed to turn volume up: %s", err)
+		}
+	case "media_volume_down":
+		if err := car.VolumeDown(ctx); err != nil {
+			return true, fmt.Errorf("failed to turn volume down: %s", err)
+		}
+	case "adjust_volume":
+		volume, err := command.getNumber("volume", true)
+		if err != nil {
+			return false, err
+		}
+		if volume < 0 || volume > 10 {
+			return false, fmt.Errorf("volume must be between 0 and 10")
+		}
+		if err := car.SetVolume(ctx, float32(volume)); err != nil {
+			return true, fmt.Errorf("failed to set volume: %s", err)
+		}
+	case "schedule_software_update":
+		offsetSec, err := command.getNumber("offset_sec", true)
+		if err != nil {
+			return false, err
+		}
+		if offsetSec < 0 {
+			return false, fmt.Errorf("offset_sec must not be negative")
+		}
+		if err := car.ScheduleSoftwareUpdate(ctx, time.Duration(offsetSec)*time.Second); err != nil {
+			return true, fmt.Errorf("failed to schedule software update: %s", err)
+		}
+	case "cancel_software_update":
+		if err := car.CancelSoftwareUpdate(ctx); err != nil {
+			return true, fmt.Errorf("failed to cancel software update: %s", err)
+		}
 	case "flash_lights":
 		if err := car.FlashLights(ctx); err != nil {
 			return true, fmt.Errorf("failed to flash lights: %s", err)
@@ -130,6 +501,80 @@ func (command *Command) Send(ctx context.Context, car *vehicle.Vehicle) (shouldR
 		if err := car.ChangeChargeLimit(ctx, chargeLimit); err != nil {
 			return true, fmt.Errorf("failed to set charge limit to %d %%: %s", chargeLimit, err)
 		}
+	case "set_scheduled_charging":
+		enable, err := command.getBool("enable", true)
+		if err != nil {
+			return false, err
+		}
+		scheduledTime, err := command.getTimeAfterMidnight("time", enable)
+		if err != nil {
+			return false, err
+		}
+		if err := car.ScheduleCharging(ctx, enable, scheduledTime); err != nil {
+			return true, fmt.Errorf("failed to set scheduled charging: %s", err)
+		}
+	case "set_scheduled_departure":
+		enable, err := command.getBool("enable", true)
+		if err != nil {
+			return false, err
+		}
+		if !enable {
+			if err := car.ClearScheduledDeparture(ctx); err != nil {
+				return true, fmt.Errorf("failed to clear scheduled departure: %s", err)
+			}
+			break
+		}
+		departureTime, err := command.getTimeAfterMidnight("departure_time", true)
+		if err != nil {
+			return false, err
+		}
+		endOffPeakTime, err := command.getTimeAfterMidnight("end_off_peak_time", false)
+		if err != nil {
+			return false, err
+		}
+		preconditioningPolicy, err := command.getPolicy("preconditioning_enabled", "preconditioning_weekdays_only")
+		if err != nil {
+			return false, err
+		}
+		offPeakPolicy, err := command.getPolicy("off_peak_charging_enabled", "off_peak_charging_weekdays_only")
+		if err != nil {
+			return false, err
+		}
+		if err := car.ScheduleDeparture(ctx, departureTime, endOffPeakTime, preconditioningPolicy, offPeakPolicy); err != nil {
+			return true, fmt.Errorf("failed to set scheduled departure: %s", err)
+		}
+	case "add_charge_schedule":
+		schedule, err := command.chargeSchedule()
+		if err != nil {
+			return false, err
+		}
+		if err := car.AddChargeSchedule(ctx, schedule); err != nil {
+			return true, fmt.Errorf("failed to add charge schedule: %s", err)
+		}
+	case "remove_charge_schedule":
+		id, err := command.getNumber("id", true)
+		if err != nil {
+			return false, err
+		}
+		if err := car.RemoveChargeSchedule(ctx, uint64(id)); err != nil {
+			return true, fmt.Errorf("failed to remove charge schedule %d: %s", uint64(id), err)
+		}
+	case "add_precondition_schedule":
+		schedule, err := command.preconditionSchedule()
+		if err != nil {
+			return false, err
+		}
+		if err := car.AddPreconditionSchedule(ctx, schedule); err != nil {
+			return true, fmt.Errorf("failed to add precondition schedule: %s", err)
+		}
+	case "remove_precondition_schedule":
+		id, err := command.getNumber("id", true)
+		if err != nil {
+			return false, err
+		}
+		if err := car.RemovePreconditionSchedule(ctx, uint64(id)); err != nil {
+			return true, fmt.Errorf("failed to remove precondition schedule %d: %s", uint64(id), err)
+		}
 	case "session_info":
 		// Get active key files
 		_, publicKeyFile := config.GetActiveKeyFiles()
@@ -217,29 +662,80 @@ func (command *Command) Send(ctx context.Context, car *vehicle.Vehicle) (shouldR
 			return false, fmt.Errorf("missing or invalid 'endpoints' in request body")
 		}
 
-		response := make(map[string]json.RawMessage)
+		// Fetch every category only once, even if it is used by several endpoints
+		states := &carserver.VehicleData{}
+		fetched := make(map[string]bool)
+		var bodyControllerState *vcsec.VehicleStatus
 		for _, endpoint := range endpoints {
-			//log.Debugf("get: %s", endpoint)
-			category, err := GetCategory(endpoint)
+			names, err := GetCategoryNames(endpoint)
 			if err != nil {
 				return false, err
 			}
-			data, err := car.GetState(ctx, category)
-			if err != nil {
-				return true, fmt.Errorf("Failed to get vehicle data: %s", err)
+			for _, name := range names {
+				if fetched[name] {
+					continue
+				}
+				category, err := GetCategory(name)
+				if err != nil {
+					return false, err
+				}
+				data, err := car.GetState(ctx, category)
+				if err != nil {
+					return true, fmt.Errorf("Failed to get vehicle data: %s", err)
+				}
+				proto.Merge(states, data)
+				fetched[name] = true
 			}
-			/*d, err := protojson.Marshal(data)
-			if err != nil {
-				return true, fmt.Errorf("failed to marshal vehicle data: %s", err)
+			if NeedsBodyControllerState(endpoint) && bodyControllerState == nil {
+				vs, err := car.BodyControllerState(ctx)
+				if err != nil {
+					return true, fmt.Errorf("failed to get body controller state: %s", err)
+				}
+				bodyControllerState = vs
 			}
-			logging.Debugf("data: %s", d)*/
+		}
+		/*d, err := protojson.Marshal(states)
+		if err != nil {
+			return true, fmt.Errorf("failed to marshal vehicle data: %s", err)
+		}
+		logging.Debugf("data: %s", d)*/
 
+		response := make(map[string]json.RawMessage)
+		for _, endpoint := range endpoints {
 			var converted interface{}
 			switch endpoint {
 			case "charge_state":
-				converted = models.ChargeStateFromBle(data)
+				converted = models.ChargeStateFromBle(states)
 			case "climate_state":
-				converted = models.ClimateStateFromBle(data)
+				converted = models.ClimateStateFromBle(states)
+			case "drive":
+				converted = models.DriveStateFromBle(states)
+			case "closures_state":
+				converted = models.ClosuresStateFromBle(states)
+			case "charge-schedule", "charge_schedule_data":
+				converted = models.ChargeScheduleStateFromBle(states)
+			case "precondition-schedule", "preconditioning_schedule_data":
+				converted = models.PreconditioningScheduleStateFromBle(states)
+			case "tire-pressure":
+				converted = models.TirePressureStateFromBle(states)
+			case "media":
+				converted = models.MediaStateFromBle(states)
+			case "media-detail":
+				converted = models.MediaDetailStateFromBle(states)
+			case "software-update":
+				converted = models.SoftwareUpdateStateFromBle(states)
+			case "parental-controls":
+				converted = models.ParentalControlsStateFromBle(states)
+			case "location", "location_data":
+				converted = models.LocationDataFromBle(states)
+			case "drive_state":
+				converted = models.FleetDriveStateFromBle(states)
+			case "vehicle_state":
+				converted = models.VehicleStateFromBle(states, bodyControllerState)
+			case "gui_settings":
+				converted = models.GuiSettingsFromBle()
+			case "vehicle_config":
+				converted = models.VehicleConfigFromBle(states)
 			}
 			d, err := json.Marshal(converted)
 			if err != nil {
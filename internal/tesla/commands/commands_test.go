@@ -2,8 +2,12 @@ package commands
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 )
 
@@ -11,11 +15,16 @@ func TestAllExceptedCommandsImplemented(t *testing.T) {
 	// Get all case statements from the Send method by creating a dummy command
 	// and checking which commands return "unrecognized command"
 	command := &Command{}
+	car, err := vehicle.NewVehicle(&offlineConnector{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The vehicle is never reached, so the commands fail right away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
 
 	for _, expectedCmd := range ExceptedCommands {
 		command.Command = expectedCmd
-		car := &vehicle.Vehicle{}
-		ctx := context.Background()
 
 		// Try to find if command is implemented by checking if it returns
 		// "unrecognized command" error
@@ -26,3 +35,111 @@ func TestAllExceptedCommandsImplemented(t *testing.T) {
 		}
 	}
 }
+
+// offlineConnector is a connection to a vehicle that is out of range
+type offlineConnector struct{}
+
+func (c *offlineConnector) Receive() <-chan []byte { return nil }
+func (c *offlineConnector) Send(context.Context, []byte) error {
+	return errors.New("vehicle out of range")
+}
+func (c *offlineConnector) VIN() string                               { return "LRW3E7FS2NC000001" }
+func (c *offlineConnector) Close()                                    {}
+func (c *offlineConnector) PreferredAuthMethod() connector.AuthMethod { return connector.AuthMethodGCM }
+func (c *offlineConnector) RetryInterval() time.Duration              { return time.Millisecond }
+func (c *offlineConnector) AllowedLatency() time.Duration             { return time.Second }
+
+func TestBodyParsing(t *testing.T) {
+	command := &Command{Body: map[string]interface{}{
+		"on":          "true",
+		"level":       float64(2),
+		"driver_temp": "21.5",
+	}}
+
+	if on, err := command.getBool("on", true); err != nil || !on {
+		t.Errorf("getBool(on) = %v, %v; want true, nil", on, err)
+	}
+	if level, err := command.getNumber("level", true); err != nil || level != 2 {
+		t.Errorf("getNumber(level) = %v, %v; want 2, nil", level, err)
+	}
+	if temp, err := command.getNumber("driver_temp", true); err != nil || temp != 21.5 {
+		t.Errorf("getNumber(driver_temp) = %v, %v; want 21.5, nil", temp, err)
+	}
+	if _, err := command.getBool("manual_override", true); err == nil {
+		t.Error("getBool(manual_override) should fail for a missing required value")
+	}
+	if override, err := command.getBool("manual_override", false); err != nil || override {
+		t.Errorf("getBool(manual_override) = %v, %v; want false, nil", override, err)
+	}
+}
+
+func TestGetDays(t *testing.T) {
+	tests := map[interface{}]int32{
+		"Mon,Wed":  10,
+		"Mon,Tue":  6,
+		"Thu,Sat":  80,
+		"weekdays": 62,
+		"All":      127,
+		float64(3): 3,
+		"65":       65,
+	}
+	for input, expected := range tests {
+		command := &Command{Body: map[string]interface{}{"days_of_week": input}}
+		if days, err := command.getDays("days_of_week", true); err != nil || days != expected {
+			t.Errorf("getDays(%v) = %d, %v; want %d, nil", input, days, err, expected)
+		}
+	}
+
+	command := &Command{Body: map[string]interface{}{"days_of_week": "Someday"}}
+	if _, err := command.getDays("days_of_week", true); err == nil {
+		t.Error("getDays should fail for an unknown day name")
+	}
+}
+
+func TestSunRoofReached(t *testing.T) {
+	tests := []struct {
+		state       string
+		percentOpen int32
+		expected    bool
+	}{
+		{"close", 0, true},
+		{"close", 15, false},
+		{"vent", 15, true},
+		{"vent", 12, true},
+		{"vent", 0, false},
+		{"vent", 100, false},
+		{"open", 100, true},
+		{"open", 80, true},
+		{"open", 15, false},
+	}
+	for _, test := range tests {
+		if reached := sunRoofReached(test.state, test.percentOpen); reached != test.expected {
+			t.Errorf("sunRoofReached(%s, %d) = %v; want %v", test.state, test.percentOpen, reached, test.expected)
+		}
+	}
+}
+
+func TestExpandEndpoints(t *testing.T) {
+	expanded := ExpandEndpoints([]string{"Charge_State", " climate_state", "charge_state", "VEHICLE_STATE"})
+	expected := []string{"charge_state", "climate_state", "vehicle_state"}
+	if !slices.Equal(expanded, expected) {
+		t.Errorf("ExpandEndpoints = %v; want %v", expanded, expected)
+	}
+	if !NeedsBodyControllerState(expanded[2]) {
+		t.Error("vehicle_state should need the body controller state")
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	body := map[string]interface{}{"pin": "1234", "password": "secret", "limit_mph": float64(50)}
+	redacted := RedactBody(body)
+	if redacted["pin"] != "***" || redacted["password"] != "***" || redacted["limit_mph"] != float64(50) {
+		t.Errorf("unexpected redacted body %v", redacted)
+	}
+	if body["pin"] != "1234" {
+		t.Error("the original body must not be changed")
+	}
+	if RedactBody(nil) != nil {
+		t.Error("a nil body should stay nil")
+	}
+}
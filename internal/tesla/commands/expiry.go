@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/wimaha/TeslaBleHttpProxy/config"
+)
+
+// DefaultTtl returns the configured time a command of the priority class may wait in the queue, 0 if it does not expire
+func DefaultTtl(priority Priority) time.Duration {
+	if config.AppConfig == nil {
+		return 0
+	}
+	var seconds int
+	switch priority {
+	case PriorityHigh:
+		seconds = config.AppConfig.CommandTtlHigh
+	case PriorityLow:
+		seconds = config.AppConfig.CommandTtlLow
+	default:
+		seconds = config.AppConfig.CommandTtlNormal
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// ParseExpiry returns the time after which a queued command is dropped.
+// ttl is a number of seconds (0 never expires), expiresAt is a RFC 3339 time or a unix timestamp.
+// If neither is set, the default of the priority class is used. A zero time never expires.
+func ParseExpiry(ttl string, expiresAt string, priority Priority, now time.Time) (time.Time, error) {
+	switch {
+	case ttl != "" && expiresAt != "":
+		return time.Time{}, fmt.Errorf("only one of 'ttl' and 'expires_at' can be set")
+	case ttl != "":
+		seconds, err := strconv.Atoi(ttl)
+		if err != nil || seconds < 0 {
+			return time.Time{}, fmt.Errorf("invalid ttl '%s' (must be a number of seconds)", ttl)
+		}
+		if seconds == 0 {
+			return time.Time{}, nil
+		}
+		return now.Add(time.Duration(seconds) * time.Second), nil
+	case expiresAt != "":
+		expiry, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			unix, unixErr := strconv.ParseInt(expiresAt, 10, 64)
+			if unixErr != nil {
+				return time.Time{}, fmt.Errorf("invalid expires_at '%s' (must be a RFC 3339 time or a unix timestamp)", expiresAt)
+			}
+			expiry = time.Unix(unix, 0)
+		}
+		if !expiry.After(now) {
+			return time.Time{}, fmt.Errorf("expires_at '%s' is in the past", expiresAt)
+		}
+		return expiry, nil
+	}
+	return DefaultExpiry(priority, now), nil
+}
+
+// DefaultExpiry returns the expiry of a command of the priority class that is queued now
+func DefaultExpiry(priority Priority, now time.Time) time.Time {
+	if ttl := DefaultTtl(priority); ttl > 0 {
+		return now.Add(ttl)
+	}
+	return time.Time{}
+}
+
+// Expired returns true if the command was not executed before its expiry
+func (command *Command) Expired(now time.Time) bool {
+	return !command.ExpiresAt.IsZero() && now.After(command.ExpiresAt)
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+	if expiry, err := ParseExpiry("90", "", PriorityNormal, now); err != nil || !expiry.Equal(now.Add(90*time.Second)) {
+		t.Errorf("unexpected expiry for ttl: %s, %v", expiry, err)
+	}
+	if expiry, err := ParseExpiry("0", "", PriorityNormal, now); err != nil || !expiry.IsZero() {
+		t.Errorf("ttl 0 should never expire: %s, %v", expiry, err)
+	}
+	if expiry, err := ParseExpiry("", "2026-10-16T08:05:00Z", PriorityNormal, now); err != nil || !expiry.Equal(now.Add(5*time.Minute)) {
+		t.Errorf("unexpected expiry for RFC 3339 time: %s, %v", expiry, err)
+	}
+	if expiry, err := ParseExpiry("", "1792137660", PriorityNormal, now); err != nil || !expiry.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected expiry for unix timestamp: %s, %v", expiry, err)
+	}
+
+	for _, invalid := range [][2]string{{"-1", ""}, {"soon", ""}, {"", "yesterday"}, {"", "2026-10-16T07:00:00Z"}, {"10", "1792137660"}} {
+		if _, err := ParseExpiry(invalid[0], invalid[1], PriorityNormal, now); err == nil {
+			t.Errorf("expected an error for ttl '%s' and expires_at '%s'", invalid[0], invalid[1])
+		}
+	}
+}
+
+func TestCoalesceKeepsLatestExpiry(t *testing.T) {
+	now := time.Now()
+	queued := &Command{Command: "set_charging_amps", Vin: "VIN", ExpiresAt: now.Add(time.Minute)}
+	command := &Command{Command: "set_charging_amps", Vin: "VIN", ExpiresAt: now.Add(time.Second)}
+	command.Coalesce(queued)
+	if !command.ExpiresAt.Equal(queued.ExpiresAt) {
+		t.Errorf("expected the later expiry, got %s", command.ExpiresAt)
+	}
+
+	command.Coalesce(&Command{Command: "set_charging_amps", Vin: "VIN"})
+	if !command.ExpiresAt.IsZero() {
+		t.Errorf("a command that never expires should not get an expiry, got %s", command.ExpiresAt)
+	}
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // Background polls
+	PriorityNormal                 // User commands
+	PriorityHigh                   // Safety and charging commands
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+// highPriorityCommands are safety and charging commands that must not wait behind other commands
+var highPriorityCommands = []string{"charge_start", "charge_stop", "set_charging_amps", "set_charge_limit", "door_lock"}
+
+// lowPriorityCommands are reads that are usually polled in the background
+var lowPriorityCommands = []string{"vehicle_data"}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// ParsePriority parses the priority names low, normal and high
+func ParsePriority(name string) (Priority, error) {
+	for priority, priorityName := range priorityNames {
+		if strings.ToLower(name) == priorityName {
+			return priority, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority '%s' (must be 'low', 'normal' or 'high')", name)
+}
+
+// DefaultPriority returns the priority class of a command if no priority is requested
+func DefaultPriority(command string) Priority {
+	if slices.Contains(highPriorityCommands, command) {
+		return PriorityHigh
+	}
+	if slices.Contains(lowPriorityCommands, command) {
+		return PriorityLow
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// scheduleId returns the id from the request body. Like the Fleet API, a new id is generated if none is given.
+func (command *Command) scheduleId() (uint64, error) {
+	id, err := command.getNumber("id", false)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return uint64(time.Now().Unix()), nil
+	}
+	return uint64(id), nil
+}
+
+// chargeSchedule builds a charge schedule from the Fleet API add_charge_schedule body
+func (command *Command) chargeSchedule() (*vehicle.ChargeSchedule, error) {
+	lat, err := command.getNumber("lat", true)
+	if err != nil {
+		return nil, err
+	}
+	lon, err := command.getNumber("lon", true)
+	if err != nil {
+		return nil, err
+	}
+	daysOfWeek, err := command.getDays("days_of_week", true)
+	if err != nil {
+		return nil, err
+	}
+	startEnabled, err := command.getBool("start_enabled", true)
+	if err != nil {
+		return nil, err
+	}
+	startTime, err := command.getNumber("start_time", startEnabled)
+	if err != nil {
+		return nil, err
+	}
+	endEnabled, err := command.getBool("end_enabled", true)
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := command.getNumber("end_time", endEnabled)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := command.getBool("enabled", true)
+	if err != nil {
+		return nil, err
+	}
+	oneTime, err := command.getBool("one_time", false)
+	if err != nil {
+		return nil, err
+	}
+	name, err := command.getString("name", false)
+	if err != nil {
+		return nil, err
+	}
+	id, err := command.scheduleId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &vehicle.ChargeSchedule{
+		Id:           id,
+		Name:         name,
+		DaysOfWeek:   daysOfWeek,
+		StartEnabled: startEnabled,
+		StartTime:    int32(startTime),
+		EndEnabled:   endEnabled,
+		EndTime:      int32(endTime),
+		OneTime:      oneTime,
+		Enabled:      enabled,
+		Latitude:     float32(lat),
+		Longitude:    float32(lon),
+	}, nil
+}
+
+// preconditionSchedule builds a precondition schedule from the Fleet API add_precondition_schedule body
+func (command *Command) preconditionSchedule() (*vehicle.PreconditionSchedule, error) {
+	lat, err := command.getNumber("lat", true)
+	if err != nil {
+		return nil, err
+	}
+	lon, err := command.getNumber("lon", true)
+	if err != nil {
+		return nil, err
+	}
+	daysOfWeek, err := command.getDays("days_of_week", true)
+	if err != nil {
+		return nil, err
+	}
+	preconditionTime, err := command.getNumber("precondition_time", true)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := command.getBool("enabled", true)
+	if err != nil {
+		return nil, err
+	}
+	oneTime, err := command.getBool("one_time", false)
+	if err != nil {
+		return nil, err
+	}
+	name, err := command.getString("name", false)
+	if err != nil {
+		return nil, err
+	}
+	id, err := command.scheduleId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &vehicle.PreconditionSchedule{
+		Id:               id,
+		Name:             name,
+		DaysOfWeek:       daysOfWeek,
+		PreconditionTime: int32(preconditionTime),
+		OneTime:          oneTime,
+		Enabled:          enabled,
+		Latitude:         float32(lat),
+		Longitude:        float32(lon),
+	}, nil
+}
@@ -5,9 +5,13 @@ import (
 	"net/http"
 
 	"github.com/wimaha/TeslaBleHttpProxy/config"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/api/handlers"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/api/routes"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/auth"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/ble/control"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/certs"
 	"github.com/wimaha/TeslaBleHttpProxy/internal/logging"
+	"github.com/wimaha/TeslaBleHttpProxy/internal/mqtt"
 )
 
 //go:embed static/*
@@ -30,7 +34,24 @@ func main() {
 		// Continue anyway - migration failure shouldn't stop the application
 	}
 
+	if err := auth.LoadTokens(); err != nil {
+		logging.Fatal("Failed to load API tokens", "error", err)
+	}
+	if !auth.Enabled() {
+		logging.Warn(
+			"⚠️  SECURITY WARNING: API authentication is disabled. " +
+				"Everyone who can reach the proxy can read the vehicle data and send charging and climate commands. " +
+				"Set the dashboard password to enable authentication.",
+		)
+	}
+
+	if !auth.PasswordSet() {
+		logging.Warn("Dashboard password is not set. Open the dashboard to set it before anyone else in your network does.")
+	}
+
 	control.SetupBleControl()
+	handlers.StartPollers()
+	mqtt.Start()
 
 	// Warn if Owner role is active (Charging Manager is recommended for security)
 	activeRole := control.GetActiveKeyRole()
@@ -46,8 +67,23 @@ func main() {
 
 	router := routes.SetupRoutes(static, html)
 
-	logging.Info("TeslaBleHttpProxy is running!")
-	if err := http.ListenAndServe(config.AppConfig.HttpListenAddress, router); err != nil {
+	server := &http.Server{
+		Addr:    config.AppConfig.HttpListenAddress,
+		Handler: router,
+	}
+
+	var err error
+	if config.AppConfig.TlsEnabled {
+		if server.TLSConfig, err = certs.ServerConfig(config.AppConfig.TlsCertFile, config.AppConfig.TlsKeyFile, config.AppConfig.TlsClientCaFile); err != nil {
+			logging.Fatal("Failed to set up TLS", "error", err)
+		}
+		logging.Info("TeslaBleHttpProxy is running with HTTPS!")
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		logging.Info("TeslaBleHttpProxy is running!")
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		logging.Fatal("Server failed", "error", err)
 	}
 }